@@ -1,15 +1,27 @@
 
 # This script builds this project in all supported operating systems
 
-echo 'Build in all platforms'
+# the build mode is one of: prod, restricted or dev
+# prod keeps the compiled-in bucket and credentials, restricted is prod without the serve command
+# example: BUILD_MODE=restricted sh build-all-platforms.sh
+BUILD_MODE=${BUILD_MODE:-prod}
 
-echo 'Cleanup Dir: bin/*'
+# build metadata, shown by `snapr version` and sent to S3 in the User-Agent
+# the version comes from SNAPR_VERSION in the .env, unless VERSION is set
+VERSION=${VERSION:-$(sed -n 's/^SNAPR_VERSION=//p' .env 2>/dev/null)}
+COMMIT=$(git rev-parse --short HEAD 2>/dev/null)
+BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+LDFLAGS="-X snapr/util.Version=$VERSION -X snapr/util.Commit=$COMMIT -X snapr/util.BuildDate=$BUILD_DATE"
+
+echo "Build in all platforms: $BUILD_MODE $VERSION ($COMMIT)"
+
+echo "Cleanup Dir: bin/$BUILD_MODE"
 
 # remove the current bin output
-rm -rf bin/*
+rm -rf bin/$BUILD_MODE
 
 # ensure dir
-mkdir -p bin/prod
+mkdir -p bin/$BUILD_MODE
 
 echo 'Initializing pkger files'
 
@@ -31,39 +43,39 @@ echo 'Included files w/ pkger'
 echo 'Build linux'
 
 # build
-env GOOS=linux go build
+env GOOS=linux go build -tags $BUILD_MODE -ldflags "$LDFLAGS"
 
 # ensure dir
-mkdir -p bin/prod/linux
+mkdir -p bin/$BUILD_MODE/linux
 
 # move binary
-mv snapr bin/prod/linux/
+mv snapr bin/$BUILD_MODE/linux/
 
 # darwin
 # ==============================================
 echo 'Build darwin'
 
 # build
-env GOOS=darwin go build
+env GOOS=darwin go build -tags $BUILD_MODE -ldflags "$LDFLAGS"
 
 # ensure dir
-mkdir -p bin/prod/darwin
+mkdir -p bin/$BUILD_MODE/darwin
 
 # move binary
-mv snapr bin/prod/darwin/
+mv snapr bin/$BUILD_MODE/darwin/
 
 # windows
 # ==============================================
 echo 'Build windows'
 
 # build
-env GOOS=windows go build
+env GOOS=windows go build -tags $BUILD_MODE -ldflags "$LDFLAGS"
 
 # ensure dir
-mkdir -p bin/prod/windows
+mkdir -p bin/$BUILD_MODE/windows
 
 # move binary
-mv snapr.exe bin/prod/windows/
+mv snapr.exe bin/$BUILD_MODE/windows/
 
 echo 'Done building'
 
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"snapr/util"
+)
+
+// lockedFlags are the root flags for the settings that a build can lock, by env key
+var lockedFlags = map[string]string{
+	"s3-bucket":        "S3_BUCKET",
+	"s3-token":         "S3_TOKEN",
+	"s3-secret":        "S3_SECRET",
+	"s3-session-token": "S3_SESSION_TOKEN",
+}
+
+// ValidateBuildOverrides checks that no flag tries to replace a compiled-in setting that the build locks
+func (ropts *RootCmdOptions) ValidateBuildOverrides() error {
+	funcTag := "ValidateBuildOverrides"
+
+	for flag, envKey := range lockedFlags {
+		if ropts.flagsSet[flag] && util.SettingLocked(envKey) {
+			return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("option `--%s` cannot replace the compiled-in value in a %s build", flag, util.Build.Mode))
+		}
+	}
+	if len(ropts.AWSProfile) > 0 && util.SettingLocked("S3_TOKEN") {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("option `--aws-profile` cannot replace the compiled-in credentials in a %s build", util.Build.Mode))
+	}
+
+	return nil
+}
+
+// removeDisabledCommands takes the commands that the build does not allow off the root command
+func removeDisabledCommands() {
+	for _, cmd := range rootCmd.Commands() {
+		if !util.Build.CommandEnabled(cmd.Name()) {
+			rootCmd.RemoveCommand(cmd)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"snapr/snapr"
+	"snapr/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newClient gets a library client set up from the root options
+// it logs to the global logger, and asks before large changes like the cli always has
+func newClient(ropts *RootCmdOptions) (*snapr.Client, error) {
+	funcTag := "newClient"
+
+	client, err := snapr.NewClient(ropts.S3Config, nil)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get client")
+	}
+
+	client.TrashDir = ropts.TrashDir
+	client.DryRun = ropts.DryRun
+	client.JournalDir = ropts.JournalDir
+	client.Concurrency = ropts.Concurrency
+	client.History = &util.History{
+		Dir:     ropts.HistoryDir,
+		Prefix:  ropts.HistoryKey,
+		Storage: client.Storage,
+		Bucket:  client.Bucket,
+	}
+	client.Log = logrus.StandardLogger()
+	client.Confirm = func(action, key string, objects []*util.S3Object) error {
+		return confirmOperation(ropts, action, key, objects)
+	}
+
+	return client, nil
+}
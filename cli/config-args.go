@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// ConfigShowCmdOptions options
+type ConfigShowCmdOptions struct {
+	ShowProfiles bool
+}
+
+// ConfigValidateCmdOptions options
+type ConfigValidateCmdOptions struct {
+	ProbeKey string
+}
+
+// config commands
+var (
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Show and check the settings that commands run with",
+		Long:  `Settings come from flags, then env vars, then the selected profile of the config file (see "--config" and "--profile"), then the compiled-in .env.`,
+	}
+
+	configShowCmdOpts = &ConfigShowCmdOptions{}
+	configShowCmd     = &cobra.Command{
+		Use:   "show",
+		Short: "Print every effective setting and where it came from, with credentials redacted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configShowCmdOpts = configShowCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			return ConfigShowCmdRunE(rootCmdOpts, configShowCmdOpts)
+		},
+	}
+
+	configValidateCmdOpts = &ConfigValidateCmdOptions{}
+	configValidateCmd     = &cobra.Command{
+		Use:   "validate",
+		Short: "Check the credentials, the bucket region, and list, put and delete permissions on a probe key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configValidateCmdOpts = configValidateCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			return ConfigValidateCmdRunE(ctx, rootCmdOpts, configValidateCmdOpts)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *ConfigShowCmdOptions) TransformPositionalArgs(args []string) *ConfigShowCmdOptions {
+	return opts
+}
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *ConfigValidateCmdOptions) TransformPositionalArgs(args []string) *ConfigValidateCmdOptions {
+	if len(args) > 0 && len(opts.ProbeKey) == 0 {
+		opts.ProbeKey = args[0]
+	}
+	return opts
+}
+
+func init() {
+	// add commands to root
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+
+	// show
+
+	configShowCmd.Flags().BoolVar(&configShowCmdOpts.ShowProfiles,
+		"profiles", util.EnvVarBool("CONFIG_SHOW_PROFILES", false),
+		"(Optional) Also list the profiles in the config file")
+
+	// validate
+
+	configValidateCmd.Flags().StringVar(&configValidateCmdOpts.ProbeKey,
+		"probe-key", util.EnvVarString("CONFIG_VALIDATE_PROBE_KEY", ""),
+		"(Optional) Key to put and delete, to check permissions - Default of a random key under '.snapr/probe/'")
+}
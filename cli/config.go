@@ -0,0 +1,284 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"snapr/util"
+	"strings"
+)
+
+// sources of a setting, on top of the env sources
+var (
+	configSourceFlag    = "flag"
+	configSourceDefault = "default"
+)
+
+// ConfigSetting is an effective setting, and where it came from
+type ConfigSetting struct {
+	Flag   string `json:"flag,omitempty"`
+	Env    string `json:"env"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// ConfigShow is what the config show command prints
+type ConfigShow struct {
+	BuildMode  string           `json:"build_mode"`
+	ConfigFile string           `json:"config_file,omitempty"`
+	Profile    string           `json:"profile,omitempty"`
+	Profiles   []string         `json:"profiles,omitempty"`
+	Settings   []*ConfigSetting `json:"settings"`
+}
+
+// configSettings gets every root setting, with credentials redacted
+func (ropts *RootCmdOptions) configSettings() []*ConfigSetting {
+	secret := util.RedactSecret
+	settings := []*ConfigSetting{
+		{Flag: "backend", Env: "BACKEND", Value: ropts.S3Config.StorageBackend()},
+		{Flag: "s3-bucket", Env: "S3_BUCKET", Value: ropts.Bucket},
+		{Flag: "s3-region", Env: "S3_REGION", Value: ropts.Region},
+		{Flag: "s3-token", Env: "S3_TOKEN", Value: secret(ropts.Token)},
+		{Flag: "s3-secret", Env: "S3_SECRET", Value: secret(ropts.Secret)},
+		{Flag: "s3-session-token", Env: "S3_SESSION_TOKEN", Value: secret(ropts.SessionToken)},
+		{Flag: "config", Env: "CONFIG", Value: ropts.ConfigFile},
+		{Flag: "profile", Env: "PROFILE", Value: ropts.Profile},
+		{Flag: "aws-profile", Env: "AWS_PROFILE", Value: ropts.S3Config.Profile},
+		{Flag: "s3-endpoint", Env: "S3_ENDPOINT", Value: ropts.Endpoint},
+		{Flag: "s3-force-path-style", Env: "S3_FORCE_PATH_STYLE", Value: fmt.Sprint(ropts.ForcePathStyle)},
+		{Flag: "s3-disable-ssl", Env: "S3_DISABLE_SSL", Value: fmt.Sprint(ropts.DisableSSL)},
+		{Flag: "s3-ca-bundle", Env: "S3_CA_BUNDLE", Value: ropts.CABundle},
+		{Flag: "s3-part-size", Env: "S3_PART_SIZE", Value: fmt.Sprint(ropts.PartSize)},
+		{Flag: "s3-part-concurrency", Env: "S3_PART_CONCURRENCY", Value: fmt.Sprint(ropts.PartConcurrency)},
+		{Flag: "trash-dir", Env: "TRASH_DIR", Value: ropts.TrashDir},
+		{Flag: "dry-run", Env: "DRY_RUN", Value: fmt.Sprint(ropts.DryRun)},
+		{Flag: "yes", Env: "YES", Value: fmt.Sprint(ropts.Yes)},
+		{Flag: "confirm-over", Env: "CONFIRM_OVER", Value: fmt.Sprint(ropts.ConfirmOver)},
+		{Flag: "pam", Env: "PAM", Value: fmt.Sprint(ropts.PAM || util.EnvVarBool("PAM", false))},
+		{Flag: "output", Env: "OUTPUT", Value: ropts.Output},
+		{Flag: "timeout", Env: "TIMEOUT", Value: ropts.Timeout},
+		{Flag: "journal-dir", Env: "JOURNAL_DIR", Value: ropts.JournalDir},
+		{Flag: "history-dir", Env: "HISTORY_DIR", Value: ropts.HistoryDir},
+		{Flag: "history-key", Env: "HISTORY_KEY", Value: ropts.HistoryKey},
+		{Flag: "concurrency", Env: "CONCURRENCY", Value: fmt.Sprint(ropts.Concurrency)},
+		{Flag: "rate-limit", Env: "RATE_LIMIT", Value: fmt.Sprint(ropts.RateLimit)},
+		{Flag: "bandwidth-limit", Env: "BANDWIDTH_LIMIT", Value: fmt.Sprint(ropts.BandwidthLimit)},
+		{Flag: "retry-attempts", Env: "RETRY_ATTEMPTS", Value: fmt.Sprint(ropts.RetryAttempts)},
+		{Flag: "retry-delay", Env: "RETRY_DELAY", Value: ropts.RetryDelay},
+		{Flag: "retry-max-delay", Env: "RETRY_MAX_DELAY", Value: ropts.RetryMaxDelay},
+		{Flag: "retry-jitter", Env: "RETRY_JITTER", Value: fmt.Sprint(ropts.RetryJitter)},
+		{Env: "VERSION", Value: util.EnvVarString("VERSION", "")},
+	}
+
+	for _, setting := range settings {
+		switch _, envSource := util.LookupEnvVar(setting.Env); {
+		case len(setting.Flag) > 0 && ropts.flagsSet[setting.Flag]:
+			setting.Source = configSourceFlag
+		case len(envSource) > 0:
+			setting.Source = envSource
+		default:
+			setting.Source = configSourceDefault
+		}
+		setting.Env = util.EnvVarName(setting.Env)
+	}
+
+	return settings
+}
+
+// ConfigShowCmdRunE runs the config show command
+// it is exported for testing
+func ConfigShowCmdRunE(ropts *RootCmdOptions, opts *ConfigShowCmdOptions) error {
+	funcTag := "configShow"
+
+	show := &ConfigShow{
+		BuildMode: util.Build.Mode,
+		Profile:   ropts.configProfile,
+		Settings:  ropts.configSettings(),
+	}
+	if ropts.config != nil {
+		show.ConfigFile = ropts.config.Path
+		if opts.ShowProfiles {
+			show.Profiles = ropts.config.ProfileNames()
+		}
+	}
+
+	switch ropts.Output {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(show)
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to encode config as json")
+		}
+		return nil
+
+	case OutputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, setting := range show.Settings {
+			err := enc.Encode(setting)
+			if err != nil {
+				return util.WrapError(err, funcTag, "failed to encode config as ndjson")
+			}
+		}
+		return nil
+	}
+
+	configFile := show.ConfigFile
+	if len(configFile) == 0 {
+		configFile = "(none)"
+	}
+	fmt.Printf("Build mode: %s\n", show.BuildMode)
+	fmt.Printf("Config file: %s\n", configFile)
+	if len(show.Profile) > 0 {
+		fmt.Printf("Profile: %s\n", show.Profile)
+	}
+	if len(show.Profiles) > 0 {
+		fmt.Printf("Profiles: %s\n", strings.Join(show.Profiles, ", "))
+	}
+	fmt.Println()
+	for _, setting := range show.Settings {
+		flag := ""
+		if len(setting.Flag) > 0 {
+			flag = "--" + setting.Flag
+		}
+		fmt.Printf("%-22s  %-28s  %-12s  %s\n", flag, setting.Env, setting.Source, setting.Value)
+	}
+
+	return nil
+}
+
+// ConfigCheck is one check of config validate
+type ConfigCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// ConfigValidateCmdRunE runs the config validate command
+// every check runs, even after one fails, so that every problem shows at once
+// it is exported for testing
+func ConfigValidateCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *ConfigValidateCmdOptions) error {
+	funcTag := "configValidate"
+
+	var checks []*ConfigCheck
+	check := func(name string, err error, detail string) bool {
+		c := &ConfigCheck{Name: name, OK: err == nil, Detail: detail}
+		if err != nil {
+			c.Detail = err.Error()
+		}
+		checks = append(checks, c)
+		return c.OK
+	}
+	skip := func(name, detail string) {
+		checks = append(checks, &ConfigCheck{Name: name, OK: true, Skipped: true, Detail: detail})
+	}
+
+	s3Config := ropts.S3Config
+	if len(s3Config.Bucket) == 0 {
+		check("bucket", fmt.Errorf("no bucket is set, use `--s3-bucket` or a profile"), "")
+	} else {
+		check("bucket", nil, s3Config.Bucket)
+	}
+
+	// credentials and region only mean something for s3
+	reachable := len(s3Config.Bucket) > 0
+	switch {
+	case !reachable:
+		skip("credentials", "no bucket")
+		skip("region", "no bucket")
+	case s3Config.StorageBackend() == util.StorageBackendS3:
+		source, err := util.S3CredentialsSource(s3Config)
+		reachable = check("credentials", err, source)
+
+		if reachable {
+			region, err := util.S3BucketRegion(ctx, s3Config)
+			if err == nil && len(s3Config.Region) > 0 && len(s3Config.Endpoint) == 0 && region != s3Config.Region {
+				err = fmt.Errorf("bucket is in region '%s', but '%s' is set", region, s3Config.Region)
+			}
+			check("region", err, region)
+		}
+	default:
+		skip("credentials", fmt.Sprintf("not used by the %s backend", s3Config.StorageBackend()))
+		skip("region", fmt.Sprintf("not used by the %s backend", s3Config.StorageBackend()))
+	}
+
+	// permissions, on a key that nothing else uses
+	probeKey := opts.ProbeKey
+	if len(probeKey) == 0 {
+		suffix := make([]byte, 6)
+		rand.Read(suffix)
+		probeKey = util.JoinS3Path(".snapr/probe", hex.EncodeToString(suffix))
+	}
+
+	var storage util.Storage
+	var err error
+	if reachable {
+		storage, err = util.NewStorage(s3Config)
+		reachable = check("storage", err, s3Config.StorageBackend())
+	}
+	if reachable {
+		_, _, err = storage.List(ctx, s3Config.Bucket, probeKey, true)
+		check("list", err, probeKey)
+
+		if ropts.DryRun {
+			skip("put", "dry run")
+			skip("delete", "dry run")
+		} else {
+			err = storage.Put(ctx, s3Config.Bucket, "private", probeKey, bytes.NewReader([]byte("snapr config validate\n")))
+			if check("put", err, probeKey) {
+				err = storage.Delete(ctx, s3Config.Bucket, probeKey)
+				check("delete", err, probeKey)
+			} else {
+				skip("delete", "nothing was put")
+			}
+		}
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if !c.OK {
+			failed++
+		}
+	}
+
+	switch ropts.Output {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(checks)
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to encode checks as json")
+		}
+
+	case OutputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, c := range checks {
+			err = enc.Encode(c)
+			if err != nil {
+				return util.WrapError(err, funcTag, "failed to encode checks as ndjson")
+			}
+		}
+
+	default:
+		for _, c := range checks {
+			status := "OK"
+			switch {
+			case c.Skipped:
+				status = "SKIP"
+			case !c.OK:
+				status = "FAIL"
+			}
+			fmt.Printf("%-4s  %-11s  %s\n", status, c.Name, c.Detail)
+		}
+	}
+
+	if failed > 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("%d of %d checks failed", failed, len(checks)))
+	}
+	return nil
+}
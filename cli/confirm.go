@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"snapr/util"
+	"strings"
+)
+
+// confirmOperation asks before changing more than `--confirm-over` objects
+// dry runs and `--yes` are never asked, and anything but "y" or "yes" cancels
+func confirmOperation(ropts *RootCmdOptions, action, key string, objects []*util.S3Object) error {
+	funcTag := "confirmOperation"
+
+	if ropts.DryRun || ropts.Yes || len(objects) <= ropts.ConfirmOver {
+		return nil
+	}
+
+	var size int64
+	for _, obj := range objects {
+		size += obj.Size
+	}
+
+	fmt.Fprintf(os.Stderr, "About to %s %d objects (%s) under '%s'. Continue? [y/N]: ", action, len(objects), util.FormatBytes(size), key)
+
+	// no terminal (or no answer) is a no
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return util.WrapError(fmt.Errorf("cancelled"), funcTag, fmt.Sprintf("did not %s %d objects, use `--yes` to skip this confirmation", action, len(objects)))
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"snapr/util"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ValidateTimeout checks the `--timeout` duration
+func (ropts *RootCmdOptions) ValidateTimeout() error {
+	funcTag := "ValidateTimeout"
+
+	ropts.timeout = 0
+	if len(ropts.Timeout) == 0 {
+		return nil
+	}
+
+	timeout, err := time.ParseDuration(ropts.Timeout)
+	if err != nil || timeout < 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("option `--timeout` must be a duration, like 30m: %s", ropts.Timeout))
+	}
+	ropts.timeout = timeout
+
+	return nil
+}
+
+// commandContext gets the context that a command runs in
+// the first interrupt cancels it, so that workers stop starting new keys, and the partial report is still written
+// a second interrupt quits right away
+// it is also cancelled after `--timeout`, when set
+// the storage backends log to the global logger through it, like the commands do
+func commandContext(ropts *RootCmdOptions) (context.Context, context.CancelFunc) {
+	interrupted, interrupt := context.WithCancel(util.WithLogger(context.Background(), logrus.StandardLogger()))
+
+	ctx, cancelTimeout := interrupted, context.CancelFunc(func() {})
+	if ropts.timeout > 0 {
+		ctx, cancelTimeout = context.WithTimeout(interrupted, ropts.timeout)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			logrus.Warnf("%s: finishing the work in flight, and starting nothing new - %s again to quit now", sig, sig)
+			interrupt()
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			logrus.Warnf("%s: quitting now", sig)
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancelTimeout()
+		interrupt()
+	}
+}
@@ -10,8 +10,11 @@ import (
 
 // DeleteCmdOptions options
 type DeleteCmdOptions struct {
-	S3Key string
-	IsDir bool
+	S3Key     string
+	IsDir     bool
+	Permanent bool
+	Resume    string
+	Workers   int
 }
 
 // upload command
@@ -24,7 +27,10 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			deleteCmdOpts = deleteCmdOpts.TransformPositionalArgs(args)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return DeleteCmdRunE(rootCmdOpts, deleteCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := DeleteCmdRunE(ctx, rootCmdOpts, deleteCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
 		},
 	}
 )
@@ -53,4 +59,19 @@ func init() {
 	deleteCmd.Flags().BoolVar(&deleteCmdOpts.IsDir,
 		"s3-is-dir", util.EnvVarBool("DELETE_S3_IS_DIR", false),
 		"(Optional) Set this option to delete an entire S3 directory")
+
+	// skip the trash
+	deleteCmd.Flags().BoolVar(&deleteCmdOpts.Permanent,
+		"permanent", util.EnvVarBool("DELETE_PERMANENT", false),
+		"(Optional) Set this option to delete permanently, instead of moving to the trash")
+
+	// pick up where a stopped run left off
+	deleteCmd.Flags().StringVar(&deleteCmdOpts.Resume,
+		"resume", util.EnvVarString("DELETE_RESUME", ""),
+		"(Optional) Journal file of a stopped run to continue deleting from - Its options are used instead of these")
+
+	// how many at once
+	deleteCmd.Flags().IntVar(&deleteCmdOpts.Workers,
+		"workers", util.EnvVarInt("DELETE_WORKERS", 0),
+		"(Optional) Number of objects to delete at once - Overrides --concurrency, default of 100")
 }
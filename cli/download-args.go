@@ -10,9 +10,11 @@ import (
 
 // DownloadCmdOptions options
 type DownloadCmdOptions struct {
-	S3Key  string
-	IsDir  bool
-	OutDir string
+	S3Key   string
+	IsDir   bool
+	OutDir  string
+	Resume  string
+	Workers int
 }
 
 // upload command
@@ -25,7 +27,10 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			downloadCmdOpts = downloadCmdOpts.TransformPositionalArgs(args)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return DownloadCmdRunE(rootCmdOpts, downloadCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := DownloadCmdRunE(ctx, rootCmdOpts, downloadCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
 		},
 	}
 )
@@ -59,4 +64,14 @@ func init() {
 	downloadCmd.Flags().BoolVar(&downloadCmdOpts.IsDir,
 		"s3-is-dir", util.EnvVarBool("DOWNLOAD_S3_IS_DIR", false),
 		"(Optional) Set this option to download an entire S3 directory")
+
+	// pick up where a stopped run left off
+	downloadCmd.Flags().StringVar(&downloadCmdOpts.Resume,
+		"resume", util.EnvVarString("DOWNLOAD_RESUME", ""),
+		"(Optional) Journal file of a stopped run to continue downloading from - Its options are used instead of these")
+
+	// how many at once
+	downloadCmd.Flags().IntVar(&downloadCmdOpts.Workers,
+		"workers", util.EnvVarInt("DOWNLOAD_WORKERS", 0),
+		"(Optional) Number of objects to download at once - Overrides --concurrency, default of 50")
 }
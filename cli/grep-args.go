@@ -17,6 +17,9 @@ type GrepCmdOptions struct {
 	SearchPattern   string
 	SearchIsLiteral bool
 	TruncationLimit int
+	Since           string
+	Until           string
+	Workers         int
 }
 
 // upload command
@@ -28,8 +31,13 @@ var (
 		Long:  `Do you like turtles?`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			grepCmdOpts = grepCmdOpts.TransformPositionalArgs(args)
+			// the config profile can set the default prefixes
+			envDefault(cmd, "s3-dir", "GREP_S3_DIR", &grepCmdOpts.S3Dir)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return GrepCmdRunE(rootCmdOpts, grepCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := GrepCmdRunE(ctx, rootCmdOpts, grepCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
 		},
 	}
 )
@@ -87,4 +95,19 @@ func init() {
 		"s3-key", util.EnvVarString("GREP_S3_KEY", ""),
 		`(Optional) Set this to search only a specific object (S3 Key). 
 		Can be a partial matched key as well.`)
+
+	// date window start
+	grepCmd.Flags().StringVar(&grepCmdOpts.Since,
+		"since", util.EnvVarString("GREP_SINCE", ""),
+		"(Optional) Only search objects modified at or after this time - A timestamp (RFC3339), date (2006-01-02) or duration ago (24h)")
+
+	// date window end
+	grepCmd.Flags().StringVar(&grepCmdOpts.Until,
+		"until", util.EnvVarString("GREP_UNTIL", ""),
+		"(Optional) Only search objects modified before this time - A timestamp (RFC3339), date (2006-01-02) or duration ago (24h)")
+
+	// how many at once
+	grepCmd.Flags().IntVar(&grepCmdOpts.Workers,
+		"workers", util.EnvVarInt("GREP_WORKERS", 0),
+		"(Optional) Number of objects to search at once - Overrides --concurrency, default of 30")
 }
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// HistoryCmdOptions options
+type HistoryCmdOptions struct {
+	Limit int
+}
+
+// history command
+var (
+	historyCmdOpts = &HistoryCmdOptions{}
+	historyCmd     = &cobra.Command{
+		Use:   "history",
+		Short: "List recent renames, copies and deletes, newest first",
+		Long:  `Every rename, copy and delete is recorded with the keys that it moved, so that it can be undone with "snapr undo <operation-id>".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			historyCmdOpts = historyCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			return HistoryCmdRunE(ctx, rootCmdOpts, historyCmdOpts)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *HistoryCmdOptions) TransformPositionalArgs(args []string) *HistoryCmdOptions {
+	return opts
+}
+
+func init() {
+	// add command to root
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().IntVarP(&historyCmdOpts.Limit,
+		"limit", "n", util.EnvVarInt("HISTORY_LIMIT", 20),
+		"(Optional) Number of operations to list - Use 0 for all of them")
+}
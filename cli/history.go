@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"snapr/util"
+)
+
+// HistoryCmdRunE runs the history command
+// it is exported for testing
+func HistoryCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *HistoryCmdOptions) error {
+	funcTag := "history"
+
+	client, err := newClient(ropts)
+	if err != nil {
+		return util.WrapError(err, funcTag, "failed to get client")
+	}
+
+	entries, err := client.History.List(ctx, opts.Limit)
+	if err != nil {
+		return util.WrapError(err, funcTag, "failed to list history")
+	}
+
+	switch ropts.Output {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to encode history as json")
+		}
+		return nil
+
+	case OutputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, entry := range entries {
+			err = enc.Encode(entry)
+			if err != nil {
+				return util.WrapError(err, funcTag, "failed to encode history as ndjson")
+			}
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		undone := ""
+		if entry.UndoneAt != nil {
+			undone = "  (undone)"
+		}
+		fmt.Printf("%s  %s  %-6s  %6d objects  %-12s  %s%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.ID, entry.Operation, len(entry.Moves), entry.User, entry.Key, undone)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// LsCmdOptions options
+type LsCmdOptions struct {
+	S3Key     string
+	Recursive bool
+	Long      bool
+	Human     bool
+	SortBy    string
+	Reverse   bool
+}
+
+// ls command
+var (
+	lsCmdOpts = &LsCmdOptions{}
+	lsCmd     = &cobra.Command{
+		Use:   "ls",
+		Short: "List the objects and directories under a key",
+		Long:  `List the objects and directories under a key, like "ls" on a filesystem.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lsCmdOpts = lsCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			return LsCmdRunE(ctx, rootCmdOpts, lsCmdOpts)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *LsCmdOptions) TransformPositionalArgs(args []string) *LsCmdOptions {
+	// `snapr ls path/to/dir/` is the same as `snapr ls --s3-key=path/to/dir/`
+	if len(args) > 0 && len(opts.S3Key) == 0 {
+		opts.S3Key = args[0]
+	}
+	return opts
+}
+
+func init() {
+	// add command to root
+	rootCmd.AddCommand(lsCmd)
+
+	// this is what gets listed
+	lsCmd.Flags().StringVar(&lsCmdOpts.S3Key,
+		"s3-key", util.EnvVarString("LS_S3_KEY", ""),
+		"(Optional) S3 Key prefix to list - End with '/' to list inside of a directory")
+
+	// all the way down?
+	lsCmd.Flags().BoolVarP(&lsCmdOpts.Recursive,
+		"recursive", "r", util.EnvVarBool("LS_RECURSIVE", false),
+		"(Optional) List every object under the key, instead of one directory level")
+
+	// long format
+	lsCmd.Flags().BoolVarP(&lsCmdOpts.Long,
+		"long", "l", util.EnvVarBool("LS_LONG", false),
+		"(Optional) Show last modified, size, storage class and etag")
+
+	// human readable sizes
+	lsCmd.Flags().BoolVarP(&lsCmdOpts.Human,
+		"human", "H", util.EnvVarBool("LS_HUMAN", false),
+		"(Optional) Show sizes like '1.5 MiB' instead of bytes")
+
+	// sorting
+	lsCmd.Flags().StringVar(&lsCmdOpts.SortBy,
+		"sort", util.EnvVarString("LS_SORT", "name"),
+		"(Optional) Sort by one of: [name,size,date]")
+
+	// sort direction
+	lsCmd.Flags().BoolVar(&lsCmdOpts.Reverse,
+		"reverse", util.EnvVarBool("LS_REVERSE", false),
+		"(Optional) Reverse the sort order")
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"snapr/util"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LsEntry is a single line of a listing
+type LsEntry struct {
+	Key          string    `json:"key"`
+	IsDir        bool      `json:"is_dir"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	StorageClass string    `json:"storage_class"`
+	ETag         string    `json:"etag"`
+}
+
+// LsCmdRunE runs the ls command
+// it is exported for testing
+func LsCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *LsCmdOptions) error {
+	funcTag := "ls"
+	// logrus.Infof(funcTag)
+	var err error
+
+	// ------  VALIDATE -----------------------------------
+
+	opts.SortBy = strings.ToLower(opts.SortBy)
+	if len(opts.SortBy) == 0 {
+		opts.SortBy = "name"
+	}
+	if opts.SortBy != "name" && opts.SortBy != "size" && opts.SortBy != "date" {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("unsupported value for `--sort`: %s", opts.SortBy))
+	}
+
+	// ls also writes csv
+	err = ropts.ValidateOutput(OutputCSV)
+	if err != nil {
+		return util.WrapError(err, funcTag, "invalid output format")
+	}
+
+	// ------  LIST OBJECTS -----------------------------------
+
+	// get the storage backend
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		return util.WrapError(err, funcTag, "failed to get storage backend")
+	}
+
+	// recursive lists everything, otherwise use the delimiter for one level
+	objects, folders, err := storage.List(ctx, ropts.Bucket, opts.S3Key, !opts.Recursive)
+	if err != nil {
+		return util.WrapError(err, funcTag, fmt.Sprintf("failed to get a list bucket objects for key: %s", opts.S3Key))
+	}
+
+	// ------  SORT -----------------------------------
+
+	// directories always come first, by name
+	var entries []*LsEntry
+	for _, folder := range folders {
+		entries = append(entries, &LsEntry{Key: folder.Key, IsDir: true})
+	}
+	sort.SliceStable(entries, func(a, b int) bool {
+		if opts.Reverse {
+			return entries[a].Key > entries[b].Key
+		}
+		return entries[a].Key < entries[b].Key
+	})
+
+	var files []*LsEntry
+	for _, obj := range objects {
+		files = append(files, &LsEntry{
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			StorageClass: obj.StorageClass,
+			ETag:         strings.Trim(obj.ETag, `"`),
+		})
+	}
+	sort.SliceStable(files, func(a, b int) bool {
+		if opts.Reverse {
+			a, b = b, a
+		}
+		switch opts.SortBy {
+		case "size":
+			return files[a].Size < files[b].Size
+		case "date":
+			return files[a].LastModified.Before(files[b].LastModified)
+		}
+		return files[a].Key < files[b].Key
+	})
+	entries = append(entries, files...)
+
+	// ------  OUTPUT -----------------------------------
+
+	switch ropts.Output {
+	case OutputJSON:
+		// always an array, even if empty
+		if entries == nil {
+			entries = []*LsEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to encode listing as json")
+		}
+
+	case OutputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			err = enc.Encode(e)
+			if err != nil {
+				return util.WrapError(err, funcTag, "failed to encode listing as ndjson")
+			}
+		}
+
+	case OutputCSV:
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"key", "is_dir", "size", "last_modified", "storage_class", "etag"})
+		for _, e := range entries {
+			lastModified := ""
+			if !e.LastModified.IsZero() {
+				lastModified = e.LastModified.Format(time.RFC3339)
+			}
+			w.Write([]string{e.Key, strconv.FormatBool(e.IsDir), strconv.FormatInt(e.Size, 10), lastModified, e.StorageClass, e.ETag})
+		}
+		w.Flush()
+		err = w.Error()
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to write listing as csv")
+		}
+
+	default:
+		for _, e := range entries {
+			if !opts.Long {
+				fmt.Println(e.Key)
+				continue
+			}
+			fmt.Println(formatLsLongEntry(e, opts.Human))
+		}
+	}
+
+	return nil
+}
+
+// formatLsLongEntry formats an entry for the long text listing
+func formatLsLongEntry(e *LsEntry, human bool) string {
+	// directories have no details
+	if e.IsDir {
+		return fmt.Sprintf("%19s  %10s  %-12s  %-32s  %s", "", "DIR", "", "", e.Key)
+	}
+
+	size := strconv.FormatInt(e.Size, 10)
+	if human {
+		size = util.FormatBytes(e.Size)
+	}
+
+	lastModified := ""
+	if !e.LastModified.IsZero() {
+		lastModified = e.LastModified.Local().Format("2006-01-02 15:04:05")
+	}
+
+	return fmt.Sprintf("%19s  %10s  %-12s  %-32s  %s", lastModified, size, e.StorageClass, e.ETag, e.Key)
+}
@@ -19,6 +19,8 @@ type ProcessCmdOptions struct {
 	IsDestPublic bool
 	RebuildAll   bool
 	RebuildNew   bool
+	Resume       string
+	Workers      int
 }
 
 // upload command
@@ -30,8 +32,14 @@ var (
 		Long:  `Do you like turtles?`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			processCmdOpts = processCmdOpts.TransformPositionalArgs(args)
+			// the config profile can set the default prefixes
+			envDefault(cmd, "s3-src-key", "PROCESS_S3_SRC_KEY", &processCmdOpts.S3SrcKey)
+			envDefault(cmd, "s3-dest-key", "PROCESS_S3_DEST_KEY", &processCmdOpts.S3DestKey)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return ProcessCmdRunE(rootCmdOpts, processCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := ProcessCmdRunE(ctx, rootCmdOpts, processCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
 		},
 	}
 )
@@ -81,4 +89,13 @@ func init() {
 		"rebuild-new", util.EnvVarBool("PROCESS_REBUILD_NEW", false),
 		"(Optional) Process files that exist in the src which do not exist in the dest")
 
+	// pick up where a stopped run left off
+	processCmd.Flags().StringVar(&processCmdOpts.Resume,
+		"resume", util.EnvVarString("PROCESS_RESUME", ""),
+		"(Optional) Journal file of a stopped run to continue processing from - Its options are used instead of these")
+
+	// how many at once
+	processCmd.Flags().IntVar(&processCmdOpts.Workers,
+		"workers", util.EnvVarInt("PROCESS_WORKERS", 0),
+		"(Optional) Number of objects to process at once - Overrides --concurrency, default of 5")
 }
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// LoadConfig reads the config file, and puts the selected profile under the env
+// the default file is optional, but a file given with `--config` is not
+// a `--profile` that is not in the file is left as an aws profile
+func (ropts *RootCmdOptions) LoadConfig() error {
+	funcTag := "LoadConfig"
+
+	ropts.config = nil
+	ropts.configProfile = ""
+	util.SetProfileEnv(nil)
+
+	if len(ropts.ConfigFile) == 0 {
+		ropts.ConfigFile = util.EnvVarString("CONFIG", "")
+	}
+	path := ropts.ConfigFile
+	if len(path) == 0 {
+		path = util.DefaultConfigPath()
+		if _, err := os.Stat(path); len(path) == 0 || os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	config, err := util.LoadConfig(path)
+	if err != nil {
+		return util.WrapError(err, funcTag, "failed to load config")
+	}
+	ropts.config = config
+
+	// the flag, then the env, then the default of the file
+	name := ropts.Profile
+	if len(name) == 0 {
+		name = util.EnvVarString("PROFILE", "")
+	}
+	if len(name) == 0 {
+		name = config.Profile
+		if len(name) > 0 && config.Profiles[name] == nil {
+			return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("default profile '%s' is not in config file: %s", name, config.Path))
+		}
+	}
+
+	profile := config.Profiles[name]
+	if profile == nil {
+		return nil
+	}
+	util.SetProfileEnv(profile.Env())
+	ropts.configProfile = name
+
+	return nil
+}
+
+// envDefault reads the env default of a flag again, unless it was set
+// flag defaults are read when the cli starts, before the config profile and the compiled-in .env are applied
+func envDefault(cmd *cobra.Command, flag, envKey string, value *string) {
+	if !cmd.Flags().Changed(flag) {
+		*value = util.EnvVarString(envKey, *value)
+	}
+}
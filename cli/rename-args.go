@@ -16,12 +16,13 @@ type RenameCmdOptions struct {
 	SrcIsDir        bool
 	IsCopyOperation bool
 	IsDestPublic    bool
-}
+	Resume          string
+	Workers         int
 
-// RenameCmdOperationTracker helps track rename operations
-type RenameCmdOperationTracker struct {
-	Source *util.S3Object
-	Dest   *util.S3Object
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+	Metadata           map[string]string
 }
 
 // upload command
@@ -34,7 +35,10 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			renameCmdOpts = renameCmdOpts.TransformPositionalArgs(args)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return RenameCmdRunE(rootCmdOpts, renameCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := RenameCmdRunE(ctx, rootCmdOpts, renameCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
 		},
 	}
 )
@@ -83,4 +87,28 @@ func init() {
 	renameCmd.Flags().BoolVar(&renameCmdOpts.IsDestPublic,
 		"s3-dest-is-public", util.EnvVarBool("RENAME_S3_DEST_IS_PUBLIC", false),
 		"(Optional) Use this to copy as a publicly available file, otherwise its private. Requires a public S3!")
+
+	// pick up where a stopped run left off
+	renameCmd.Flags().StringVar(&renameCmdOpts.Resume,
+		"resume", util.EnvVarString("RENAME_RESUME", ""),
+		"(Optional) Journal file of a stopped run to continue renaming from - Its options are used instead of these")
+
+	// how many at once
+	renameCmd.Flags().IntVar(&renameCmdOpts.Workers,
+		"workers", util.EnvVarInt("RENAME_WORKERS", 0),
+		"(Optional) Number of objects to rename at once - Overrides --concurrency, default of 100")
+
+	// headers to change on the copies, everything else is kept
+	renameCmd.Flags().StringVar(&renameCmdOpts.ContentType,
+		"content-type", util.EnvVarString("RENAME_CONTENT_TYPE", ""),
+		"(Optional) Content type to set on the copies, like image/jpeg - Otherwise, kept from the source")
+	renameCmd.Flags().StringVar(&renameCmdOpts.ContentDisposition,
+		"content-disposition", util.EnvVarString("RENAME_CONTENT_DISPOSITION", ""),
+		"(Optional) Content disposition to set on the copies, like inline - Otherwise, kept from the source")
+	renameCmd.Flags().StringVar(&renameCmdOpts.CacheControl,
+		"cache-control", util.EnvVarString("RENAME_CACHE_CONTROL", ""),
+		"(Optional) Cache control to set on the copies, like max-age=86400 - Otherwise, kept from the source")
+	renameCmd.Flags().StringToStringVar(&renameCmdOpts.Metadata,
+		"metadata", util.EnvVarStringMap("RENAME_METADATA", map[string]string{}),
+		"(Optional) Metadata to add to the copies (comma delimited) - Example: owner=me,album=2020")
 }
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"snapr/util"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// output formats for `--output`
+// logs always go to stderr, so stdout only has the results
+var (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputNDJSON = "ndjson"
+	OutputCSV    = "csv"
+)
+
+// ValidateOutput checks the `--output` format
+// extra formats are for commands that support more than the common ones
+func (ropts *RootCmdOptions) ValidateOutput(extra ...string) error {
+	funcTag := "ValidateOutput"
+
+	ropts.Output = strings.ToLower(ropts.Output)
+	if len(ropts.Output) == 0 {
+		ropts.Output = OutputText
+	}
+
+	for _, format := range append([]string{OutputText, OutputJSON, OutputNDJSON}, extra...) {
+		if ropts.Output == format {
+			return nil
+		}
+	}
+	return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("unsupported value for `--output`: %s", ropts.Output))
+}
+
+// outputOrEnv gets the `--output` format, or the one from the env
+func (ropts *RootCmdOptions) outputOrEnv() string {
+	if len(ropts.Output) == 0 {
+		return util.EnvVarString("OUTPUT", OutputText)
+	}
+	return ropts.Output
+}
+
+// writeOperationReport shows what a command did, and what failed, in the `--output` format
+// it passes through the error from the command, so it can be returned from cobra
+func writeOperationReport(ropts *RootCmdOptions, report *util.OperationReport, cmdErr error) error {
+	funcTag := "writeOperationReport"
+
+	if report == nil {
+		return cmdErr
+	}
+	for _, failure := range report.Failed {
+		logrus.Warnf("FAILED: %s: %s", failure.Key, failure.Error)
+	}
+	logrus.Infof("REPORT: %s", report.Summary())
+
+	var err error
+	switch ropts.Output {
+	case OutputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+
+	case OutputNDJSON:
+		// one line per result, then the report itself, without the results
+		enc := json.NewEncoder(os.Stdout)
+		for _, result := range report.Results {
+			err = enc.Encode(result)
+			if err != nil {
+				break
+			}
+		}
+		if err == nil {
+			results := report.Results
+			report.Results = nil
+			err = enc.Encode(report)
+			report.Results = results
+		}
+	}
+	if err != nil && cmdErr == nil {
+		return util.WrapError(err, funcTag, "failed to write report")
+	}
+
+	return cmdErr
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"fmt"
+	"snapr/util"
+	"time"
+)
+
+// ValidateRetryPolicy checks the `--retry-*` options
+func (ropts *RootCmdOptions) ValidateRetryPolicy() error {
+	funcTag := "ValidateRetryPolicy"
+
+	if ropts.RetryAttempts < 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("option `--retry-attempts` cannot be negative: %d", ropts.RetryAttempts))
+	}
+	for flag, value := range map[string]string{"--retry-delay": ropts.RetryDelay, "--retry-max-delay": ropts.RetryMaxDelay} {
+		if len(value) == 0 {
+			continue
+		}
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay < 0 {
+			return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("option `%s` must be a duration, like 500ms: %s", flag, value))
+		}
+	}
+	if ropts.RetryJitter < 0 || ropts.RetryJitter > 1 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("option `--retry-jitter` must be from 0 to 1: %g", ropts.RetryJitter))
+	}
+
+	return nil
+}
+
+// retryPolicy gets the retry policy from the `--retry-*` options
+// anything that is not set, or not valid, uses the default
+// 0 attempts is the same as 1, the first try and no retries
+func (ropts *RootCmdOptions) retryPolicy() util.RetryPolicy {
+	baseDelay, _ := time.ParseDuration(ropts.RetryDelay)
+	maxDelay, _ := time.ParseDuration(ropts.RetryMaxDelay)
+	attempts := ropts.RetryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	return util.RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   baseDelay,
+		MaxDelay:    maxDelay,
+		Jitter:      ropts.RetryJitter,
+		NoJitter:    ropts.RetryJitter == 0,
+	}
+}
@@ -1,19 +1,58 @@
 package cli
 
 import (
+	"path/filepath"
 	"snapr/util"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // RootCmdOptions are for root flags
 type RootCmdOptions struct {
-	Bucket   string
-	Region   string
-	Token    string
-	Secret   string
-	S3Config *util.S3Accessor
+	Backend         string
+	Bucket          string
+	Region          string
+	Token           string
+	Secret          string
+	SessionToken    string
+	Profile         string
+	AWSProfile      string
+	ConfigFile      string
+	Endpoint        string
+	ForcePathStyle  bool
+	DisableSSL      bool
+	CABundle        string
+	PartSize        int64
+	PartConcurrency int
+	TrashDir        string
+	DryRun          bool
+	Yes             bool
+	ConfirmOver     int
+	PAM             bool
+	Output          string
+	Timeout         string
+	JournalDir      string
+	HistoryDir      string
+	HistoryKey      string
+	Concurrency     int
+	RateLimit       float64
+	BandwidthLimit  float64
+	RetryAttempts   int
+	RetryDelay      string
+	RetryMaxDelay   string
+	RetryJitter     float64
+	S3Config        *util.S3Accessor
+
+	// parsed from Timeout
+	timeout time.Duration
+	// the config file, and the name of the selected profile in it
+	config        *util.Config
+	configProfile string
+	// root flags that were set on the command line, by name
+	flagsSet map[string]bool
 	// FileCreateMode os.FileMode
 }
 
@@ -24,6 +63,36 @@ var (
 		Use:   "snapr",
 		Short: "Snapr is a snapper turtle.",
 		Long:  `Do you like turtles?`,
+		// runs before every command, so bad options fail before anything happens
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// the profile goes under the flags and env, so it is loaded first
+			rootCmdOpts.flagsSet = map[string]bool{}
+			cmd.Flags().Visit(func(flag *pflag.Flag) {
+				rootCmdOpts.flagsSet[flag.Name] = true
+			})
+			err := rootCmdOpts.ValidateBuildOverrides()
+			if err != nil {
+				return err
+			}
+			err = rootCmdOpts.LoadConfig()
+			if err != nil {
+				return err
+			}
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			err = rootCmdOpts.ValidateTimeout()
+			if err != nil {
+				return err
+			}
+			err = rootCmdOpts.ValidateRetryPolicy()
+			if err != nil {
+				return err
+			}
+			// ls also writes csv
+			if cmd == lsCmd {
+				return rootCmdOpts.ValidateOutput(OutputCSV)
+			}
+			return rootCmdOpts.ValidateOutput()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// initialize the s3 config
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
@@ -40,10 +109,15 @@ var (
 func init() {
 	// root flags defined here
 
+	// storage backend
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Backend,
+		"backend", "",
+		"(Optional) Storage Backend - Supported Backends: [s3,fs] - A 'file://' bucket always uses fs")
+
 	// s3 bucket
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Bucket,
 		"s3-bucket", "",
-		"(Optional) S3 Bucket Identifier")
+		"(Optional) S3 Bucket Identifier - Use 'file:///some/dir' for a local directory")
 
 	// s3 region
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Region,
@@ -53,12 +127,127 @@ func init() {
 	// s3 token
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Token,
 		"s3-token", "",
-		"(Optional) S3 User Token")
+		"(Optional) S3 User Token - Without a token and secret, the standard AWS credential chain is used")
 
 	// s3 secret
 	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Secret,
 		"s3-secret", "",
-		"(Optional) S3 User Secret")
+		"(Optional) S3 User Secret - Without a token and secret, the standard AWS credential chain is used")
+
+	// temporary credentials
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.SessionToken,
+		"s3-session-token", "",
+		"(Optional) S3 Session Token - For temporary credentials, with the token and secret")
+
+	// config file profiles, and the aws credential chain
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.ConfigFile,
+		"config", "",
+		"(Optional) Config file with named profiles - Default of '~/.config/snapr/config.yaml'")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Profile,
+		"profile", "",
+		"(Optional) Profile in the config file - Otherwise a named profile in ~/.aws/credentials and ~/.aws/config")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.AWSProfile,
+		"aws-profile", "",
+		"(Optional) Named profile in ~/.aws/credentials and ~/.aws/config - Used instead of the token and secret")
+
+	// s3 compatible endpoint
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Endpoint,
+		"s3-endpoint", "",
+		"(Optional) S3 Endpoint URL - Use this for S3 compatible services like MinIO, Ceph or Wasabi")
+
+	// path style addressing
+	rootCmd.PersistentFlags().BoolVar(&rootCmdOpts.ForcePathStyle,
+		"s3-force-path-style", false,
+		"(Optional) Use path style addressing (endpoint/bucket/key) instead of virtual hosts - Most S3 compatible services need this")
+
+	// plain http
+	rootCmd.PersistentFlags().BoolVar(&rootCmdOpts.DisableSSL,
+		"s3-disable-ssl", false,
+		"(Optional) Talk to the S3 endpoint without TLS")
+
+	// custom certificate authority
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.CABundle,
+		"s3-ca-bundle", "",
+		"(Optional) Path to a PEM file of certificate authorities to trust for the S3 endpoint")
+
+	// multipart part size
+	rootCmd.PersistentFlags().Int64Var(&rootCmdOpts.PartSize,
+		"s3-part-size", 0,
+		"(Optional) Multipart transfer part size in MiB - Minimum of 5, default of 5")
+
+	// multipart concurrency
+	rootCmd.PersistentFlags().IntVar(&rootCmdOpts.PartConcurrency,
+		"s3-part-concurrency", 0,
+		"(Optional) Number of parts of a single object to transfer in parallel - Default of 5")
+
+	// soft delete
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.TrashDir,
+		"trash-dir", "",
+		"(Optional) Key prefix that deleted objects are moved to - Default of '.trash'")
+
+	// safety
+	rootCmd.PersistentFlags().BoolVar(&rootCmdOpts.DryRun,
+		"dry-run", false,
+		"(Optional) Print the keys that would be changed, without changing anything")
+	rootCmd.PersistentFlags().BoolVarP(&rootCmdOpts.Yes,
+		"yes", "y", false,
+		"(Optional) Do not ask for confirmation before changing many objects")
+	rootCmd.PersistentFlags().IntVar(&rootCmdOpts.ConfirmOver,
+		"confirm-over", 0,
+		"(Optional) Ask for confirmation before changing more than this many objects - Default of 100")
+
+	// login hooks
+	rootCmd.PersistentFlags().BoolVar(&rootCmdOpts.PAM,
+		"pam", false,
+		"(Optional) Always exit with status 0, even on failure - For PAM login hooks, where a non-zero status blocks the login")
+
+	// results
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Output,
+		"output", "",
+		"(Optional) Output format for results on stdout, one of: [text,json,ndjson] - Logs always go to stderr")
+
+	// limits
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.Timeout,
+		"timeout", "",
+		"(Optional) Stop the command after this long, like 30m - The partial report is still written")
+
+	// resuming
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.JournalDir,
+		"journal-dir", "",
+		"(Optional) Directory that directory operations keep a journal in, to resume them from - Default of '.snapr/journal'")
+
+	// undoing
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.HistoryDir,
+		"history-dir", "",
+		"(Optional) Directory that renames, copies and deletes are recorded in, to undo them from - Default of '.snapr/history'")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.HistoryKey,
+		"history-key", "",
+		"(Optional) Key prefix to also record operations under in the bucket, like '.snapr/history' - Shares the history with other machines")
+
+	// throttling
+	rootCmd.PersistentFlags().IntVar(&rootCmdOpts.Concurrency,
+		"concurrency", 0,
+		"(Optional) Number of objects every command works on at once - Each command has its own default, and its own --workers override")
+	rootCmd.PersistentFlags().Float64Var(&rootCmdOpts.RateLimit,
+		"rate-limit", 0,
+		"(Optional) Maximum requests per second to s3, shared by all workers - Every page, part, batch and retry counts - Default of no limit")
+	rootCmd.PersistentFlags().Float64Var(&rootCmdOpts.BandwidthLimit,
+		"bandwidth-limit", 0,
+		"(Optional) Maximum transfer rate in MB/s (MiB), shared by all workers - Default of no limit")
+
+	// transient errors, like throttling or a dropped connection
+	rootCmd.PersistentFlags().IntVar(&rootCmdOpts.RetryAttempts,
+		"retry-attempts", 0,
+		"(Optional) Times to try a request that failed for a passing reason, like SlowDown or a 503 - Use 0 or 1 to never retry, default of 5")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.RetryDelay,
+		"retry-delay", "",
+		"(Optional) Wait before the first retry, doubled for every retry after it - Default of 200ms")
+	rootCmd.PersistentFlags().StringVar(&rootCmdOpts.RetryMaxDelay,
+		"retry-max-delay", "",
+		"(Optional) Longest wait between retries - Default of 20s")
+	rootCmd.PersistentFlags().Float64Var(&rootCmdOpts.RetryJitter,
+		"retry-jitter", 0,
+		"(Optional) Part of each wait, from 0 to 1, that is random, so that workers do not retry together - Default of 0.5")
 }
 
 // SetupS3ConfigFromRootArgs initializes the s3 config from env
@@ -68,6 +257,18 @@ func (ropts *RootCmdOptions) SetupS3ConfigFromRootArgs() *RootCmdOptions {
 	// if cli did not have these set, then default to env with default
 	// we don't want to show the defaults to the user
 	// in the cli prompts if set in the env from packr build
+	// a build that does not allow overrides keeps the compiled-in bucket and credentials
+	for _, setting := range []struct {
+		envKey string
+		value  *string
+	}{{"S3_BUCKET", &ropts.Bucket}, {"S3_TOKEN", &ropts.Token}, {"S3_SECRET", &ropts.Secret}, {"S3_SESSION_TOKEN", &ropts.SessionToken}} {
+		if util.SettingLocked(setting.envKey) {
+			*setting.value = util.EnvVarString(setting.envKey, "")
+		}
+	}
+	if len(ropts.Backend) == 0 {
+		ropts.Backend = util.EnvVarString("BACKEND", "")
+	}
 	if len(ropts.Bucket) == 0 {
 		ropts.Bucket = util.EnvVarString("S3_BUCKET", "")
 	}
@@ -80,18 +281,138 @@ func (ropts *RootCmdOptions) SetupS3ConfigFromRootArgs() *RootCmdOptions {
 	if len(ropts.Secret) == 0 {
 		ropts.Secret = util.EnvVarString("S3_SECRET", "")
 	}
+	if len(ropts.SessionToken) == 0 {
+		ropts.SessionToken = util.EnvVarString("S3_SESSION_TOKEN", "")
+	}
+	if len(ropts.AWSProfile) == 0 {
+		ropts.AWSProfile = util.EnvVarString("AWS_PROFILE", "")
+	}
+	// a profile that is not in the config file is an aws profile
+	awsProfile := ropts.AWSProfile
+	if len(awsProfile) == 0 && len(ropts.configProfile) == 0 {
+		awsProfile = ropts.Profile
+		if len(awsProfile) == 0 {
+			awsProfile = util.EnvVarString("PROFILE", "")
+		}
+	}
+	// and it would go before the locked credentials
+	if util.SettingLocked("S3_TOKEN") {
+		awsProfile = ""
+	}
+	if len(ropts.Endpoint) == 0 {
+		ropts.Endpoint = util.EnvVarString("S3_ENDPOINT", "")
+	}
+	if !ropts.ForcePathStyle {
+		ropts.ForcePathStyle = util.EnvVarBool("S3_FORCE_PATH_STYLE", false)
+	}
+	if !ropts.DisableSSL {
+		ropts.DisableSSL = util.EnvVarBool("S3_DISABLE_SSL", false)
+	}
+	if len(ropts.CABundle) == 0 {
+		ropts.CABundle = util.EnvVarString("S3_CA_BUNDLE", "")
+	}
+	if ropts.PartSize == 0 {
+		ropts.PartSize = int64(util.EnvVarInt("S3_PART_SIZE", 0))
+	}
+	if ropts.PartConcurrency == 0 {
+		ropts.PartConcurrency = util.EnvVarInt("S3_PART_CONCURRENCY", 0)
+	}
+	if len(ropts.TrashDir) == 0 {
+		ropts.TrashDir = util.EnvVarString("TRASH_DIR", ".trash")
+	}
+	if !ropts.DryRun {
+		ropts.DryRun = util.EnvVarBool("DRY_RUN", false)
+	}
+	if !ropts.Yes {
+		ropts.Yes = util.EnvVarBool("YES", false)
+	}
+	if ropts.ConfirmOver == 0 {
+		ropts.ConfirmOver = util.EnvVarInt("CONFIRM_OVER", 100)
+	}
+	ropts.Output = ropts.outputOrEnv()
+	if len(ropts.Timeout) == 0 {
+		ropts.Timeout = util.EnvVarString("TIMEOUT", "")
+	}
+	if len(ropts.JournalDir) == 0 {
+		ropts.JournalDir = util.EnvVarString("JOURNAL_DIR", filepath.Join(".snapr", "journal"))
+	}
+	if len(ropts.HistoryDir) == 0 {
+		ropts.HistoryDir = util.EnvVarString("HISTORY_DIR", filepath.Join(".snapr", "history"))
+	}
+	if len(ropts.HistoryKey) == 0 {
+		ropts.HistoryKey = util.EnvVarString("HISTORY_KEY", "")
+	}
+	if ropts.Concurrency == 0 {
+		ropts.Concurrency = util.EnvVarInt("CONCURRENCY", 0)
+	}
+	if ropts.RateLimit == 0 {
+		ropts.RateLimit = util.EnvVarFloat("RATE_LIMIT", 0)
+	}
+	if ropts.BandwidthLimit == 0 {
+		ropts.BandwidthLimit = util.EnvVarFloat("BANDWIDTH_LIMIT", 0)
+	}
+	// 0 is a setting of its own for these, so only a flag that was not given is read from the env
+	if ropts.RetryAttempts == 0 && !ropts.flagsSet["retry-attempts"] {
+		ropts.RetryAttempts = util.EnvVarInt("RETRY_ATTEMPTS", 5)
+	}
+	if len(ropts.RetryDelay) == 0 {
+		ropts.RetryDelay = util.EnvVarString("RETRY_DELAY", "200ms")
+	}
+	if len(ropts.RetryMaxDelay) == 0 {
+		ropts.RetryMaxDelay = util.EnvVarString("RETRY_MAX_DELAY", "20s")
+	}
+	if ropts.RetryJitter == 0 && !ropts.flagsSet["retry-jitter"] {
+		ropts.RetryJitter = util.EnvVarFloat("RETRY_JITTER", 0.5)
+	}
 	// ctransform / condition
 	ropts.S3Config = &util.S3Accessor{
-		Bucket: ropts.Bucket,
-		Region: ropts.Region,
-		Token:  ropts.Token,
-		Secret: ropts.Secret,
+		Backend: ropts.Backend,
+		Bucket:  ropts.Bucket,
+		Region:  ropts.Region,
+		Token:   ropts.Token,
+		Secret:  ropts.Secret,
+
+		SessionToken: ropts.SessionToken,
+		Profile:      awsProfile,
+
+		Endpoint:       ropts.Endpoint,
+		ForcePathStyle: ropts.ForcePathStyle,
+		DisableSSL:     ropts.DisableSSL,
+		CABundle:       ropts.CABundle,
+
+		PartSize:        ropts.PartSize,
+		PartConcurrency: ropts.PartConcurrency,
+
+		RequestsPerSecond: ropts.RateLimit,
+		BandwidthMBps:     ropts.BandwidthLimit,
+
+		Retry: ropts.retryPolicy(),
 	}
 	// logrus.Infof("ROPTS: %+v", ropts)
 	return ropts
 }
 
+// workers gets how many objects a command works on at once
+// the command's own `--workers` comes first, then `--concurrency`, then the command's default
+func (ropts *RootCmdOptions) workers(workers, defaultWorkers int) int {
+	if workers > 0 {
+		return workers
+	}
+	if ropts.Concurrency > 0 {
+		return ropts.Concurrency
+	}
+	return defaultWorkers
+}
+
 // Execute starts the cli
 func Execute() error {
+	removeDisabledCommands()
+	setupVersionFlag()
 	return rootCmd.Execute()
 }
+
+// IsPAMMode tells if failures should still exit with status 0
+// this works even when the command failed before the root args were set up
+func IsPAMMode() bool {
+	return rootCmdOpts.PAM || util.EnvVarBool("PAM", false)
+}
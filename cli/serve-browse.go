@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/http"
@@ -9,7 +10,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,6 +26,7 @@ func ServeCmdBrowseHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 	funcTag := "ServeCmdBrowseHandler"
 	var err error
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := util.WithLogger(r.Context(), logrus.StandardLogger())
 		// logrus.Infof("REQUEST (%s): %s, %s, %s", funcTag, r.Method, r.URL, r.RequestURI)
 
 		// only respond to post request (from browser)
@@ -52,10 +53,10 @@ func ServeCmdBrowseHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 		}
 		// logrus.Infof("QP: %s", qpS3SubKey)
 
-		// get a new s3 client
-		_, s3Client, err := util.NewS3Client(ropts.S3Config)
+		// get the storage backend
+		storage, err := util.NewStorage(ropts.S3Config)
 		if err != nil {
-			err = util.WrapError(err, funcTag, "failed to get a new s3 client")
+			err = util.WrapError(err, funcTag, "failed to get storage backend")
 			logrus.Warnf(err.Error())
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -69,7 +70,7 @@ func ServeCmdBrowseHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 
 		// get the object list
 		var objects []*util.S3Object
-		objects, p.Folders, err = util.ListS3ObjectsByKey(s3Client, ropts.Bucket, s3Key, true)
+		objects, p.Folders, err = storage.List(ctx, ropts.Bucket, s3Key, true)
 		if err != nil {
 			err = util.WrapError(err, funcTag, "failed to get bucket contents info by key")
 			logrus.Warnf(err.Error())
@@ -78,7 +79,7 @@ func ServeCmdBrowseHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 		}
 
 		// open a new go errgroup for a parrallel operation
-		eg, _ := util.NewErrGroup()
+		eg, egCtx := util.NewErrGroup(ctx)
 
 		// files and images
 		for _, obj := range objects {
@@ -98,7 +99,7 @@ func ServeCmdBrowseHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 			if isImage {
 
 				// errgroup: closure is needed
-				eg.Go(HandleImageDownloadWorker(s3Client, ropts.Bucket, obj, &p.Images, true))
+				eg.Go(HandleImageDownloadWorker(egCtx, storage, ropts.Bucket, obj, &p.Images, true))
 
 			} else {
 
@@ -130,13 +131,13 @@ func ServeCmdBrowseHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 }
 
 // HandleImageDownloadWorker handles async download and conversion of images
-func HandleImageDownloadWorker(s3Client *s3.S3, bucket string, obj *util.S3Object, accumulator *[]*util.S3Object, convertBase64 bool) func() error {
+func HandleImageDownloadWorker(ctx context.Context, storage util.Storage, bucket string, obj *util.S3Object, accumulator *[]*util.S3Object, convertBase64 bool) func() error {
 	funcTag := "HandleImageDownloadWorker"
 	var err error
 	return func() error {
 
 		// download the object to byte slice
-		obj.Bytes, err = util.DownloadS3Object(s3Client, bucket, obj.Key)
+		obj.Bytes, err = storage.Get(ctx, bucket, obj.Key)
 		if err != nil {
 			return util.WrapError(err, funcTag, fmt.Sprintf("failed to download bucket object: %s", obj.Key))
 		}
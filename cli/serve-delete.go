@@ -25,6 +25,7 @@ func ServeCmdDeleteHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 	funcTag := "ServeCmdDeleteHandler"
 	var err error
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		logrus.Infof("REQUEST (%s): %s, %s, %s", funcTag, r.Method, r.URL, r.RequestURI)
 
 		// only respond to post request (from browser)
@@ -62,9 +63,9 @@ func ServeCmdDeleteHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 			IsDir: body.IsDir,
 		}
 		// check the error
-		err = DeleteCmdRunE(rootCmdOpts, cmdArgs)
+		_, err = DeleteCmdRunE(ctx, rootCmdOpts, cmdArgs)
 		if err != nil {
-			err = fmt.Errorf("failed running delete command with opts: %+v: %s", cmdArgs, err)
+			err = fmt.Errorf("failed running delete command with opts: %s: %s", util.QueryString(cmdArgs), err)
 			logrus.Warnf(err.Error())
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -72,7 +73,7 @@ func ServeCmdDeleteHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 
 		// success message
 		resp := DeleteResponse{
-			Message: fmt.Sprintf("Object Deleted: %s", body.Key),
+			Message: fmt.Sprintf("Object Moved to Trash: %s", body.Key),
 		}
 
 		// success message
@@ -26,6 +26,7 @@ func ServeCmdDownloadHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(
 	funcTag := "ServeCmdBrowseHandler"
 	var err error
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		logrus.Infof("REQUEST (%s): %s, %s, %s", funcTag, r.Method, r.URL, r.RequestURI)
 
 		// only respond to post request (from browser)
@@ -52,9 +53,9 @@ func ServeCmdDownloadHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(
 			IsDir: body.IsDir,
 		}
 		// check the error
-		err = DownloadCmdRunE(rootCmdOpts, cmdArgs)
+		_, err = DownloadCmdRunE(ctx, rootCmdOpts, cmdArgs)
 		if err != nil {
-			err = fmt.Errorf("failed running download command with opts: %+v: %s", cmdArgs, err)
+			err = fmt.Errorf("failed running download command with opts: %s: %s", util.QueryString(cmdArgs), err)
 			logrus.Warnf(err.Error())
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -27,6 +27,7 @@ func ServeCmdRenameHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 	funcTag := "ServeCmdRenameHandler"
 	var err error
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		logrus.Infof("REQUEST (%s): %s, %s, %s", funcTag, r.Method, r.URL, r.RequestURI)
 
 		// only respond to post request (from browser)
@@ -71,9 +72,9 @@ func ServeCmdRenameHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w
 			IsCopyOperation: body.Copy,
 		}
 		// check the error
-		err = RenameCmdRunE(rootCmdOpts, cmdArgs)
+		_, err = RenameCmdRunE(ctx, rootCmdOpts, cmdArgs)
 		if err != nil {
-			err = fmt.Errorf("failed running rename command with opts: %+v: %s", cmdArgs, err)
+			err = fmt.Errorf("failed running rename command with opts: %s: %s", util.QueryString(cmdArgs), err)
 			logrus.Warnf(err.Error())
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -29,6 +29,7 @@ var serveCmdTmpls = []Template{
 	Template{
 		Name: `page-end`,
 		Markup: `
+			<footer><small>{{ version | html }}</small></footer>
 		</body></html>`,
 	},
 	Template{
@@ -144,6 +145,7 @@ var serveCmdTmpls = []Template{
 			</div>
 			<div>
 				<a href="browse?dir=">Home</a>
+				&nbsp;<a href="trash">Trash</a>
 			</div>
 			<div id="{{.Key}}-dir">
 				<span>Current Directory: {{.Key}}</span>
@@ -165,7 +167,7 @@ var serveCmdTmpls = []Template{
 				{{range .Files}}
 				<div id="{{.Key}}-file">
 					<p>
-						{{.Key}}
+						{{.Key}} ({{bytes .Size}})
 						&nbsp;<button onclick="downloadKey('file', '{{.Key}}')">Download</button>
 						&nbsp;<button onclick="deleteKey('file', '{{.Key}}')">Delete</button>
 						&nbsp;<button onclick="renameKey('file', '{{.Key}}')">Rename</button>
@@ -176,7 +178,7 @@ var serveCmdTmpls = []Template{
 				{{range .Images}}
 				<div id="{{.Key}}-image">
 					<p>
-						{{.Key}}
+						{{.Key}} ({{bytes .Size}})
 						&nbsp;<button onclick="downloadKey('image', '{{.Key}}')">Download</button>
 						&nbsp;<button onclick="deleteKey('image', '{{.Key}}')">Delete</button>
 						&nbsp;<button onclick="renameKey('image', '{{.Key}}')">Rename</button>
@@ -188,6 +190,44 @@ var serveCmdTmpls = []Template{
 			</div>
 		{{ template "page-end" }}`,
 	},
+	Template{
+		Name: `trash`,
+		Markup: `
+		{{ template "page-start" }}
+			{{ template "js-util" }}
+			<script>
+				const msgElemId = 'message'
+				const trashAction = (action, key) => {
+					post('trash/' + action, { key })
+						.then(res => {
+							message(res.message, msgElemId)
+							removeElem(key + '-trash')
+						})
+						.catch(err => { message(err, msgElemId) })
+				}
+			</script>
+			<div>
+				<span id="message"><span>
+			</div>
+			<div>
+				<a href="browse?dir=">Home</a>
+			</div>
+			<div>
+				<span>Trash: {{.TrashDir}} ({{len .Entries}} objects)</span>
+			</div>
+			<div id="trash-entries">
+				{{range .Entries}}
+				<div id="{{.Object.Key}}-trash">
+					<p>
+						{{.OriginalKey}} ({{bytes .Object.Size}}) deleted {{.DeletedAt.Local.Format "2006-01-02 15:04:05"}}
+						&nbsp;<button onclick="trashAction('restore', '{{.Object.Key}}')">Restore</button>
+						&nbsp;<button onclick="trashAction('purge', '{{.Object.Key}}')">Purge</button>
+					</p>
+				</div>
+				{{end}}
+			</div>
+		{{ template "page-end" }}`,
+	},
 	Template{
 		Name: `download`,
 		Markup: `
@@ -203,8 +243,15 @@ var serveCmdTmpls = []Template{
 func ParseTemplates() (*template.Template, error) {
 	funcTag := "ParseTemplates"
 
+	// functions available to all templates
+	funcs := template.FuncMap{
+		"bytes": util.FormatBytes,
+		// which binary served the page
+		"version": func() string { return util.GetVersionInfo().String() },
+	}
+
 	// parse a dumy template to get a *template.Template object
-	t, err := template.New("dummy-template").Parse("not used anywhere")
+	t, err := template.New("dummy-template").Funcs(funcs).Parse("not used anywhere")
 	if err != nil {
 		return t, util.WrapError(err, funcTag, "parsing initial template")
 	}
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"snapr/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TrashPage is the trash page in a browser
+type TrashPage struct {
+	TrashDir string
+	Entries  []*util.TrashEntry
+}
+
+// TrashRequest is the request body for a restore or purge request from the browser
+type TrashRequest struct {
+	Key string `json:"key"`
+}
+
+// TrashResponse is sent back to the requester in json format
+type TrashResponse struct {
+	Message string `json:"message"`
+}
+
+// ServeCmdTrashHandler is a handler that shows what is in the trash
+func ServeCmdTrashHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w http.ResponseWriter, r *http.Request) {
+	funcTag := "ServeCmdTrashHandler"
+	var err error
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := util.WithLogger(r.Context(), logrus.StandardLogger())
+		// logrus.Infof("REQUEST (%s): %s, %s, %s", funcTag, r.Method, r.URL, r.RequestURI)
+
+		// only respond to get request (from browser)
+		if r.Method != http.MethodGet {
+			err = fmt.Errorf("incorrect method for this endpoint: %s", r.Method)
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// get the storage backend
+		storage, err := util.NewStorage(ropts.S3Config)
+		if err != nil {
+			err = util.WrapError(err, funcTag, "failed to get storage backend")
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// build the page
+		p := &TrashPage{TrashDir: ropts.TrashDir}
+		p.Entries, err = util.ListTrash(ctx, storage, ropts.Bucket, ropts.TrashDir, false)
+		if err != nil {
+			err = util.WrapError(err, funcTag, "failed to list trash")
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// exec the template and data
+		serveCmdTempl.ExecuteTemplate(w, "trash", p)
+	}
+}
+
+// ServeCmdTrashRestoreHandler is an http handler for restoring a single object from the trash
+func ServeCmdTrashRestoreHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w http.ResponseWriter, r *http.Request) {
+	return serveCmdTrashActionHandler("ServeCmdTrashRestoreHandler", "Object Restored", func(ctx context.Context, key string) error {
+		_, err := TrashRestoreCmdRunE(ctx, ropts, &TrashRestoreCmdOptions{S3Key: key})
+		return err
+	})
+}
+
+// ServeCmdTrashPurgeHandler is an http handler for permanently deleting a single object from the trash
+func ServeCmdTrashPurgeHandler(ropts *RootCmdOptions, opts *ServeCmdOptions) func(w http.ResponseWriter, r *http.Request) {
+	return serveCmdTrashActionHandler("ServeCmdTrashPurgeHandler", "Object Purged", func(ctx context.Context, key string) error {
+		_, err := TrashPurgeCmdRunE(ctx, ropts, &TrashPurgeCmdOptions{S3Key: key, OlderThan: "0s"})
+		return err
+	})
+}
+
+// serveCmdTrashActionHandler handles a post with a key in the trash, and runs a command on it
+func serveCmdTrashActionHandler(funcTag, successMessage string, action func(ctx context.Context, key string) error) func(w http.ResponseWriter, r *http.Request) {
+	var err error
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := util.WithLogger(r.Context(), logrus.StandardLogger())
+		logrus.Infof("REQUEST (%s): %s, %s, %s", funcTag, r.Method, r.URL, r.RequestURI)
+
+		// only respond to post request (from browser)
+		if r.Method != http.MethodPost {
+			err = fmt.Errorf("incorrect method for this endpoint: %s", r.Method)
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// decode the request body
+		var body TrashRequest
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			err = util.WrapError(fmt.Errorf("validation error"), funcTag, "failed to parse request body")
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// validate key
+		if len(body.Key) == 0 {
+			err = util.WrapError(fmt.Errorf("validation error"), funcTag, "no `key` provided in body")
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// fire the cli command
+		err = action(ctx, body.Key)
+		if err != nil {
+			err = fmt.Errorf("failed running trash command for key: %s: %s", body.Key, err)
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// success message
+		resp := TrashResponse{
+			Message: fmt.Sprintf("%s: %s", successMessage, body.Key),
+		}
+
+		// success message
+		err = json.NewEncoder(w).Encode(&resp)
+		if err != nil {
+			err = fmt.Errorf("could not encode response")
+			logrus.Warnf(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+}
@@ -30,6 +30,9 @@ func ServeCmdRunE(ropts *RootCmdOptions, opts *ServeCmdOptions) error {
 		}
 	}
 
+	// clicking in the browser is the confirmation, there is no one at the terminal to ask
+	ropts.Yes = true
+
 	// parse templates
 	serveCmdTempl, err = ParseTemplates()
 	if err != nil {
@@ -42,6 +45,9 @@ func ServeCmdRunE(ropts *RootCmdOptions, opts *ServeCmdOptions) error {
 	http.HandleFunc("/download", ServeCmdDownloadHandler(ropts, opts))
 	http.HandleFunc("/delete", ServeCmdDeleteHandler(ropts, opts))
 	http.HandleFunc("/rename", ServeCmdRenameHandler(ropts, opts))
+	http.HandleFunc("/trash", ServeCmdTrashHandler(ropts, opts))
+	http.HandleFunc("/trash/restore", ServeCmdTrashRestoreHandler(ropts, opts))
+	http.HandleFunc("/trash/purge", ServeCmdTrashPurgeHandler(ropts, opts))
 	http.HandleFunc("/", ServeCmd404NotFoundHandler(ropts, opts))
 	logrus.Infof("Handlers registered")
 
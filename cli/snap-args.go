@@ -32,7 +32,9 @@ var (
 		RunE: func(cmd *cobra.Command, args []string) error {
 			snapCmdOpts = snapCmdOpts.TransformPositionalArgs(args)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return SnapCmdRunE(rootCmdOpts, snapCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			return SnapCmdRunE(ctx, rootCmdOpts, snapCmdOpts)
 		},
 	}
 )
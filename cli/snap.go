@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"image/png"
 	"os"
@@ -17,7 +18,7 @@ import (
 
 // SnapCmdRunE runs the snap command
 // it is exported for testing
-func SnapCmdRunE(ropts *RootCmdOptions, opts *SnapCmdOptions) error {
+func SnapCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *SnapCmdOptions) error {
 	funcTag := "SnapCmdRunE"
 	// logrus.Infof(funcTag)
 	var err error
@@ -251,7 +252,7 @@ func SnapCmdRunE(ropts *RootCmdOptions, opts *SnapCmdOptions) error {
 		// overwrite existing file if any
 		ffmpegExecString := fmt.Sprintf("ffmpeg %s %s %s %s %s \"%s\" -y", driverType, framerate, resolution, webcamAddr, vframes, outFilePath)
 		logrus.Infof("Camera Command: %s", ffmpegExecString)
-		ffmpegExec := exec.Command("/bin/sh", "-c", ffmpegExecString)
+		ffmpegExec := exec.CommandContext(ctx, "/bin/sh", "-c", ffmpegExecString)
 
 		// execute and wait
 		err = ffmpegExec.Run()
@@ -273,8 +274,8 @@ func SnapCmdRunE(ropts *RootCmdOptions, opts *SnapCmdOptions) error {
 				InFile:              fileName,
 				CleanupAfterSuccess: opts.CleanupAfterUpload,
 			}
-			logrus.Infof("Running Upload for scrrenshot: %+v", uOpts)
-			err = UploadCmdRunE(ropts, uOpts)
+			logrus.Infof("Running Upload for scrrenshot: %s", util.QueryString(uOpts))
+			_, err = UploadCmdRunE(ctx, ropts, uOpts)
 			if err != nil {
 				return util.WrapError(err, funcTag, "uploading after success")
 			}
@@ -287,8 +288,8 @@ func SnapCmdRunE(ropts *RootCmdOptions, opts *SnapCmdOptions) error {
 				InFile:              fileName,
 				CleanupAfterSuccess: opts.CleanupAfterUpload,
 			}
-			logrus.Infof("Running Upload for webcam: %+v", uOpts)
-			err = UploadCmdRunE(ropts, uOpts)
+			logrus.Infof("Running Upload for webcam: %s", util.QueryString(uOpts))
+			_, err = UploadCmdRunE(ctx, ropts, uOpts)
 			if err != nil {
 				return util.WrapError(err, funcTag, "uploading after success")
 			}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// SyncCmdOptions options
+type SyncCmdOptions struct {
+	Dir          string
+	S3SrcKey     string
+	S3DestKey    string
+	S3DestBucket string
+	IsDestPublic bool
+	Delete       bool
+	Permanent    bool
+	Compare      string
+	Includes     []string
+	Excludes     []string
+	Workers      int
+}
+
+// sync command
+var (
+	syncCmdOpts = &SyncCmdOptions{}
+	syncCmd     = &cobra.Command{
+		Use:   "sync",
+		Short: "One way mirror from a directory to a bucket, a bucket to a directory, or a bucket to a bucket",
+		Long: `One way mirror from a directory to a bucket, a bucket to a directory, or a bucket to a bucket.
+Only new and changed files are transferred.
+
+  --dir + --s3-dest-key          directory => bucket
+  --s3-src-key + --dir           bucket => directory
+  --s3-src-key + --s3-dest-key   bucket => bucket (see --s3-dest-bucket)`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			syncCmdOpts = syncCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := SyncCmdRunE(ctx, rootCmdOpts, syncCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *SyncCmdOptions) TransformPositionalArgs(args []string) *SyncCmdOptions {
+	// if len(args) > 0 {
+	// // can use env vars, too!
+	// 	opts.Something = args[0]
+	// }
+	return opts
+}
+
+func init() {
+	// add command to root
+	rootCmd.AddCommand(syncCmd)
+
+	// local side of the sync
+	syncCmd.Flags().StringVar(&syncCmdOpts.Dir,
+		"dir", util.EnvVarString("SYNC_DIR", ""),
+		"(Optional) Local Directory - The source when used with '--s3-dest-key', otherwise the destination")
+
+	// bucket source
+	syncCmd.Flags().StringVar(&syncCmdOpts.S3SrcKey,
+		"s3-src-key", util.EnvVarString("SYNC_S3_SRC_KEY", ""),
+		"(Optional) S3 Directory to sync from")
+
+	// bucket destination
+	syncCmd.Flags().StringVar(&syncCmdOpts.S3DestKey,
+		"s3-dest-key", util.EnvVarString("SYNC_S3_DEST_KEY", ""),
+		"(Optional) S3 Directory to sync to")
+
+	// other bucket destination
+	syncCmd.Flags().StringVar(&syncCmdOpts.S3DestBucket,
+		"s3-dest-bucket", util.EnvVarString("SYNC_S3_DEST_BUCKET", ""),
+		"(Optional) S3 Bucket to sync to, otherwise, same bucket")
+
+	// is the destination public?
+	syncCmd.Flags().BoolVar(&syncCmdOpts.IsDestPublic,
+		"s3-dest-is-public", util.EnvVarBool("SYNC_S3_DEST_IS_PUBLIC", false),
+		"(Optional) Use this to sync as publicly available files, otherwise they are private. Requires a public S3!")
+
+	// remove extras?
+	syncCmd.Flags().BoolVar(&syncCmdOpts.Delete,
+		"delete", util.EnvVarBool("SYNC_DELETE", false),
+		"(Optional) Delete files in the destination that do not exist in the source - Objects in a bucket are moved to the trash")
+
+	// skip the trash
+	syncCmd.Flags().BoolVar(&syncCmdOpts.Permanent,
+		"permanent", util.EnvVarBool("SYNC_PERMANENT", false),
+		"(Optional) With '--delete', delete objects permanently, instead of moving them to the trash - Local files are always removed")
+
+	// how to tell if a file changed
+	syncCmd.Flags().StringVar(&syncCmdOpts.Compare,
+		"compare", util.EnvVarString("SYNC_COMPARE", "etag"),
+		"(Optional) How to detect changes along with size, one of: [etag,mtime] - etag falls back to mtime when a checksum is not available")
+
+	// include patterns
+	syncCmd.Flags().StringSliceVar(&syncCmdOpts.Includes,
+		"include", util.EnvVarStringSlice("SYNC_INCLUDE", []string{}),
+		"(Optional) Only sync keys matching these patterns (comma delimited) - Example: *.jpg,albums/*")
+
+	// exclude patterns
+	syncCmd.Flags().StringSliceVar(&syncCmdOpts.Excludes,
+		"exclude", util.EnvVarStringSlice("SYNC_EXCLUDE", []string{}),
+		"(Optional) Do not sync keys matching these patterns (comma delimited) - Example: *.tmp,.trash/*")
+
+	// how many at once
+	syncCmd.Flags().IntVar(&syncCmdOpts.Workers,
+		"workers", util.EnvVarInt("SYNC_WORKERS", 0),
+		"(Optional) Number of objects to sync at once - Overrides --concurrency, default of 20")
+}
@@ -0,0 +1,502 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"snapr/util"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+	"github.com/sirupsen/logrus"
+)
+
+// SyncEntry is a file or object on one side of a sync
+type SyncEntry struct {
+	// key relative to the root of the side, always with the s3 delimiter
+	RelKey string `json:"rel_key"`
+	// local path or full s3 key
+	Location     string    `json:"location"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	IsLocal      bool      `json:"is_local"`
+}
+
+// SyncCmdOperation is a single transfer or delete planned by the sync command
+// deletes have no source, and objects that were moved to the trash have a trash key
+type SyncCmdOperation struct {
+	Source   *SyncEntry `json:"source,omitempty"`
+	Dest     *SyncEntry `json:"dest"`
+	Reason   string     `json:"reason"`
+	TrashKey string     `json:"trash_key,omitempty"`
+}
+
+// SyncCmdRunE runs the sync command
+// it is exported for testing
+func SyncCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *SyncCmdOptions) (*util.OperationReport, error) {
+	funcTag := "sync"
+	// logrus.Infof(funcTag)
+	var err error
+
+	// ------  VALIDATE -----------------------------------
+
+	// figure out the direction
+	isUpload := len(opts.Dir) > 0 && len(opts.S3DestKey) > 0 && len(opts.S3SrcKey) == 0
+	isDownload := len(opts.Dir) > 0 && len(opts.S3SrcKey) > 0 && len(opts.S3DestKey) == 0
+	isCopy := len(opts.Dir) == 0 && len(opts.S3SrcKey) > 0 && len(opts.S3DestKey) > 0
+	if !isUpload && !isDownload && !isCopy {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "use exactly two of `--dir`, `--s3-src-key` and `--s3-dest-key`")
+	}
+
+	// default dest bucket to current s3 bucket if not already done
+	if len(opts.S3DestBucket) == 0 {
+		opts.S3DestBucket = ropts.Bucket
+	}
+
+	// default compare mode
+	opts.Compare = strings.ToLower(opts.Compare)
+	if len(opts.Compare) == 0 {
+		opts.Compare = "etag"
+	}
+	if opts.Compare != "etag" && opts.Compare != "mtime" {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("unsupported value for `--compare`: %s", opts.Compare))
+	}
+
+	if opts.Permanent && !opts.Delete {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "option `--permanent` only applies with `--delete`")
+	}
+
+	// validate the patterns up front
+	for _, pattern := range append(opts.Includes, opts.Excludes...) {
+		_, err = filepath.Match(pattern, "")
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("invalid pattern: %s", pattern))
+		}
+	}
+
+	// make sure that it is directory, we add an extra slash
+	if len(opts.S3SrcKey) > 0 {
+		opts.S3SrcKey = util.EnsureS3DirPath(opts.S3SrcKey)
+	}
+	if len(opts.S3DestKey) > 0 {
+		opts.S3DestKey = util.EnsureS3DirPath(opts.S3DestKey)
+	}
+
+	// a bucket cannot sync into itself
+	if isCopy && strings.EqualFold(ropts.Bucket, opts.S3DestBucket) {
+		if strings.HasPrefix(opts.S3SrcKey, opts.S3DestKey) || strings.HasPrefix(opts.S3DestKey, opts.S3SrcKey) {
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("source and destination cannot overlap: '%s' vs '%s'", opts.S3SrcKey, opts.S3DestKey))
+		}
+	}
+
+	// get the abs dir path
+	if len(opts.Dir) > 0 {
+		opts.Dir, err = filepath.Abs(opts.Dir)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("cannot convert path for `--dir`: %s", opts.Dir))
+		}
+	}
+
+	// set the object acl to "private"
+	destAcl := "private"
+	// unless set to public
+	if opts.IsDestPublic {
+		destAcl = "public-read"
+	}
+
+	// track what is going on
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	// ------  LIST BOTH SIDES -----------------------------------
+
+	// get the storage backend
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get storage backend")
+	}
+
+	var srcEntries, destEntries map[string]*SyncEntry
+	switch {
+	case isUpload:
+		logrus.Infof("SYNC: %s => %s::%s", opts.Dir, opts.S3DestBucket, opts.S3DestKey)
+		srcEntries, err = listSyncDir(opts.Dir, true)
+		if err == nil {
+			destEntries, err = listSyncBucket(ctx, storage, opts.S3DestBucket, opts.S3DestKey)
+		}
+	case isDownload:
+		logrus.Infof("SYNC: %s::%s => %s", ropts.Bucket, opts.S3SrcKey, opts.Dir)
+		srcEntries, err = listSyncBucket(ctx, storage, ropts.Bucket, opts.S3SrcKey)
+		if err == nil {
+			destEntries, err = listSyncDir(opts.Dir, false)
+		}
+	case isCopy:
+		logrus.Infof("SYNC: %s::%s => %s::%s", ropts.Bucket, opts.S3SrcKey, opts.S3DestBucket, opts.S3DestKey)
+		srcEntries, err = listSyncBucket(ctx, storage, ropts.Bucket, opts.S3SrcKey)
+		if err == nil {
+			destEntries, err = listSyncBucket(ctx, storage, opts.S3DestBucket, opts.S3DestKey)
+		}
+	}
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to list sync source and destination")
+	}
+
+	logrus.Infof("SOURCE: %d, DESTINATION: %d", len(srcEntries), len(destEntries))
+
+	// ------  DIFF -----------------------------------
+
+	var transfers []*SyncCmdOperation
+	var deletes []*SyncCmdOperation
+
+	// in order, so the output is readable
+	var relKeys []string
+	for relKey := range srcEntries {
+		relKeys = append(relKeys, relKey)
+	}
+	sort.Strings(relKeys)
+
+	for _, relKey := range relKeys {
+		src := srcEntries[relKey]
+		if !matchesSyncPatterns(relKey, opts.Includes, opts.Excludes) {
+			continue
+		}
+
+		// where this goes
+		dest, exists := destEntries[relKey]
+		if !exists {
+			dest = &SyncEntry{RelKey: relKey}
+			if isDownload {
+				dest.Location = filepath.Join(opts.Dir, filepath.FromSlash(relKey))
+				dest.IsLocal = true
+			} else {
+				dest.Location = opts.S3DestKey + relKey
+			}
+		}
+
+		reason, err := syncReason(src, dest, exists, opts.Compare)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to compare: %s", relKey))
+		}
+		if len(reason) > 0 {
+			transfers = append(transfers, &SyncCmdOperation{Source: src, Dest: dest, Reason: reason})
+		} else {
+			report.Skip(dest.Location)
+		}
+	}
+
+	// extras in the destination
+	if opts.Delete {
+		relKeys = nil
+		for relKey := range destEntries {
+			relKeys = append(relKeys, relKey)
+		}
+		sort.Strings(relKeys)
+
+		for _, relKey := range relKeys {
+			if _, exists := srcEntries[relKey]; exists {
+				continue
+			}
+			// excluded files are left alone, on both sides
+			if !matchesSyncPatterns(relKey, opts.Includes, opts.Excludes) {
+				continue
+			}
+			// and so is the trash
+			if !isDownload && util.IsTrashKey(ropts.TrashDir, destEntries[relKey].Location) {
+				continue
+			}
+			deletes = append(deletes, &SyncCmdOperation{Dest: destEntries[relKey], Reason: "extra"})
+		}
+	}
+
+	logrus.Infof("TO TRANSFER: %d, TO DELETE: %d", len(transfers), len(deletes))
+
+	// extras in a bucket go to the trash, unless deleted permanently
+	trashExtras := !isDownload && !opts.Permanent
+	deletedAt := time.Now()
+	deletedBy := util.CurrentUser()
+
+	// ------  DRY RUN -----------------------------------
+
+	if ropts.DryRun {
+		for _, op := range transfers {
+			logrus.Infof("DRY RUN: (%s) %s => %s", op.Reason, op.Source.Location, op.Dest.Location)
+		}
+		for _, op := range deletes {
+			if trashExtras {
+				logrus.Infof("DRY RUN: (trash) %s => %s", op.Dest.Location, util.TrashKey(ropts.TrashDir, deletedAt, op.Dest.Location))
+			} else {
+				logrus.Infof("DRY RUN: (delete) %s", op.Dest.Location)
+			}
+		}
+		return report, report.Finish()
+	}
+
+	// ask first, for a lot of deletes
+	var deleteObjects []*util.S3Object
+	for _, op := range deletes {
+		deleteObjects = append(deleteObjects, &util.S3Object{Key: op.Dest.Location, Size: op.Dest.Size})
+	}
+	destRoot := opts.S3DestKey
+	if isDownload {
+		destRoot = opts.Dir
+	}
+	err = confirmOperation(ropts, "delete", destRoot, deleteObjects)
+	if err != nil {
+		return nil, err
+	}
+
+	// ------  TRANSFER & DELETE -----------------------------------
+
+	// open a new wait group with a maximum number of concurrent workers
+	wg := waitgroup.NewWaitGroup(ropts.workers(opts.Workers, 20))
+
+	for _, op := range append(transfers, deletes...) {
+		if report.Cancelled(ctx, op.Dest.Location) {
+			continue
+		}
+
+		// block adding until the next worker has finished
+		wg.BlockAdd()
+
+		go func(op *SyncCmdOperation) {
+			funcTag := "SyncWorker"
+			defer wg.Done()
+
+			var err error
+			switch {
+			case op.Source == nil && op.Dest.IsLocal:
+				err = os.Remove(op.Dest.Location)
+			case op.Source == nil && trashExtras:
+				op.TrashKey, err = util.TrashObject(ctx, storage, opts.S3DestBucket, ropts.TrashDir, op.Dest.Location, deletedBy, deletedAt)
+			case op.Source == nil:
+				err = storage.Delete(ctx, opts.S3DestBucket, op.Dest.Location)
+			case isUpload:
+				var info os.FileInfo
+				info, err = os.Stat(op.Source.Location)
+				if err == nil {
+					err = util.WriteFile(ctx, storage, opts.S3DestBucket, destAcl, op.Dest.Location, &util.WalkedFile{
+						Path:     op.Source.Location,
+						FileInfo: info,
+					})
+				}
+			case isDownload:
+				err = storage.Download(ctx, ropts.Bucket, op.Source.Location, op.Dest.Location)
+			case isCopy:
+				err = storage.Copy(ctx, ropts.Bucket, op.Source.Location, opts.S3DestBucket, op.Dest.Location, util.CopyOptions{ACL: destAcl})
+			}
+
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to sync: %s", op.Dest.Location))
+				logrus.Warnf(err.Error())
+				report.Fail(op.Dest.Location, err)
+				return
+			}
+
+			if op.Source == nil && trashExtras {
+				logrus.Infof("TRASHED: %s => %s", op.Dest.Location, op.TrashKey)
+				report.Succeed(op.Dest.Location, 0)
+			} else if op.Source == nil {
+				logrus.Infof("DELETED: %s", op.Dest.Location)
+				report.Succeed(op.Dest.Location, 0)
+			} else {
+				logrus.Infof("SYNCED: (%s) %s => %s", op.Reason, op.Source.Location, op.Dest.Location)
+				report.Succeed(op.Dest.Location, op.Source.Size)
+			}
+			report.AddResult(op)
+
+		}(op)
+	}
+
+	// wait on everything to complete
+	wg.Wait()
+
+	// the trashed extras are recorded like a delete, so that `undo` can put them back
+	var moves []*util.HistoryMove
+	for _, op := range deletes {
+		if len(op.TrashKey) == 0 {
+			continue
+		}
+		moves = append(moves, &util.HistoryMove{
+			SrcBucket:  opts.S3DestBucket,
+			SrcKey:     op.Dest.Location,
+			DestBucket: opts.S3DestBucket,
+			DestKey:    op.TrashKey,
+			Size:       op.Dest.Size,
+		})
+	}
+	recordSync(ropts, storage, opts.S3DestKey, moves)
+
+	err = report.Finish()
+	logrus.Infof("SYNCED: %d, FAILED: %d", len(report.Succeeded), len(report.Failed))
+
+	return report, err
+}
+
+// recordSync keeps the extras that a sync moved to the trash in the history
+// the history is saved even once the context is done, and failing to save it only warns
+func recordSync(ropts *RootCmdOptions, storage util.Storage, key string, moves []*util.HistoryMove) {
+	if len(moves) == 0 {
+		return
+	}
+
+	history := &util.History{
+		Dir:     ropts.HistoryDir,
+		Prefix:  ropts.HistoryKey,
+		Storage: storage,
+		Bucket:  ropts.Bucket,
+	}
+	entry := util.NewHistoryEntry(util.HistoryDelete, ropts.Bucket, key, moves)
+	err := history.Save(context.Background(), entry)
+	if err != nil {
+		logrus.Warnf(err.Error())
+		return
+	}
+	logrus.Infof("HISTORY: %s - Undo with `snapr undo %s`", entry.ID, entry.ID)
+}
+
+// listSyncDir gets the files in a local directory, by relative key
+func listSyncDir(dir string, mustExist bool) (map[string]*SyncEntry, error) {
+	funcTag := "listSyncDir"
+	entries := map[string]*SyncEntry{}
+
+	// stat the path
+	fileInfo, err := os.Stat(dir)
+	if os.IsNotExist(err) && !mustExist {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "cannot stat path")
+	}
+
+	// ensure is a dir
+	if !fileInfo.IsDir() {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "dir provided is not a directory")
+	}
+
+	files, err := util.WalkFiles(dir)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to walk dir: %s", dir))
+	}
+
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file.Path)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to get relative path: %s", file.Path))
+		}
+		relKey := filepath.ToSlash(rel)
+		entries[relKey] = &SyncEntry{
+			RelKey:       relKey,
+			Location:     file.Path,
+			Size:         file.FileInfo.Size(),
+			LastModified: file.FileInfo.ModTime(),
+			IsLocal:      true,
+		}
+	}
+
+	return entries, nil
+}
+
+// listSyncBucket gets the objects under a key, by relative key
+func listSyncBucket(ctx context.Context, storage util.Storage, bucket, key string) (map[string]*SyncEntry, error) {
+	funcTag := "listSyncBucket"
+	entries := map[string]*SyncEntry{}
+
+	objects, _, err := storage.List(ctx, bucket, key, false)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to get a list bucket objects for key: %s", key))
+	}
+
+	for _, obj := range objects {
+		relKey := strings.TrimPrefix(obj.Key, key)
+		// skip directory marker objects
+		if len(relKey) == 0 || strings.HasSuffix(relKey, util.S3Delimiter) {
+			continue
+		}
+		entries[relKey] = &SyncEntry{
+			RelKey:       relKey,
+			Location:     obj.Key,
+			Size:         obj.Size,
+			ETag:         strings.Trim(obj.ETag, `"`),
+			LastModified: obj.LastModified,
+		}
+	}
+
+	return entries, nil
+}
+
+// matchesSyncPatterns checks a relative key against include and exclude patterns
+// patterns match against the whole relative key, or just the file name
+func matchesSyncPatterns(relKey string, includes, excludes []string) bool {
+	matches := func(pattern string) bool {
+		if ok, _ := filepath.Match(pattern, relKey); ok {
+			return true
+		}
+		ok, _ := filepath.Match(pattern, filepath.Base(relKey))
+		return ok
+	}
+
+	if len(includes) > 0 {
+		included := false
+		for _, pattern := range includes {
+			if matches(pattern) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, pattern := range excludes {
+		if matches(pattern) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// syncReason says why a source needs to be transferred to the dest, or "" when it does not
+func syncReason(src, dest *SyncEntry, destExists bool, compare string) (string, error) {
+	if !destExists {
+		return "new", nil
+	}
+	if src.Size != dest.Size {
+		return "size", nil
+	}
+
+	if compare == "etag" {
+		// multipart etags are not a checksum of the content
+		usable := func(etag string) bool { return len(etag) > 0 && !strings.Contains(etag, "-") }
+
+		// local files are only hashed when there is something to compare them to
+		for _, pair := range [][2]*SyncEntry{{src, dest}, {dest, src}} {
+			if pair[0].IsLocal && len(pair[0].ETag) == 0 && usable(pair[1].ETag) {
+				etag, err := util.FileMD5(pair[0].Location)
+				if err != nil {
+					return "", err
+				}
+				pair[0].ETag = etag
+			}
+		}
+
+		if usable(src.ETag) && usable(dest.ETag) {
+			if !strings.EqualFold(src.ETag, dest.ETag) {
+				return "etag", nil
+			}
+			return "", nil
+		}
+	}
+
+	// no checksums to go on, so the newer file wins
+	if src.LastModified.After(dest.LastModified) {
+		return "mtime", nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// TrashListCmdOptions options
+type TrashListCmdOptions struct {
+	S3Key string
+	Long  bool
+}
+
+// TrashRestoreCmdOptions options
+type TrashRestoreCmdOptions struct {
+	S3Key     string
+	IsDir     bool
+	DeletedAt string
+	Overwrite bool
+	Workers   int
+}
+
+// TrashPurgeCmdOptions options
+type TrashPurgeCmdOptions struct {
+	S3Key     string
+	IsDir     bool
+	OlderThan string
+}
+
+// trash commands
+var (
+	trashCmd = &cobra.Command{
+		Use:   "trash",
+		Short: "List, restore and purge deleted objects",
+		Long:  `Deleted objects are moved under the trash prefix (see "--trash-dir"), in a directory named for the time of the delete.`,
+	}
+
+	trashListCmdOpts = &TrashListCmdOptions{}
+	trashListCmd     = &cobra.Command{
+		Use:   "list",
+		Short: "List deleted objects, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trashListCmdOpts = trashListCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			return TrashListCmdRunE(ctx, rootCmdOpts, trashListCmdOpts)
+		},
+	}
+
+	trashRestoreCmdOpts = &TrashRestoreCmdOptions{}
+	trashRestoreCmd     = &cobra.Command{
+		Use:   "restore",
+		Short: "Move deleted objects back to their original keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trashRestoreCmdOpts = trashRestoreCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := TrashRestoreCmdRunE(ctx, rootCmdOpts, trashRestoreCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
+		},
+	}
+
+	trashPurgeCmdOpts = &TrashPurgeCmdOptions{}
+	trashPurgeCmd     = &cobra.Command{
+		Use:   "purge",
+		Short: "Permanently delete objects from the trash",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			trashPurgeCmdOpts = trashPurgeCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := TrashPurgeCmdRunE(ctx, rootCmdOpts, trashPurgeCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *TrashListCmdOptions) TransformPositionalArgs(args []string) *TrashListCmdOptions {
+	if len(args) > 0 && len(opts.S3Key) == 0 {
+		opts.S3Key = args[0]
+	}
+	return opts
+}
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *TrashRestoreCmdOptions) TransformPositionalArgs(args []string) *TrashRestoreCmdOptions {
+	if len(args) > 0 && len(opts.S3Key) == 0 {
+		opts.S3Key = args[0]
+	}
+	return opts
+}
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *TrashPurgeCmdOptions) TransformPositionalArgs(args []string) *TrashPurgeCmdOptions {
+	if len(args) > 0 && len(opts.S3Key) == 0 {
+		opts.S3Key = args[0]
+	}
+	return opts
+}
+
+func init() {
+	// add commands to root
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+	trashCmd.AddCommand(trashPurgeCmd)
+
+	// list
+
+	trashListCmd.Flags().StringVar(&trashListCmdOpts.S3Key,
+		"s3-key", util.EnvVarString("TRASH_LIST_S3_KEY", ""),
+		"(Optional) Only list deleted objects whose original key starts with this")
+
+	trashListCmd.Flags().BoolVarP(&trashListCmdOpts.Long,
+		"long", "l", util.EnvVarBool("TRASH_LIST_LONG", false),
+		"(Optional) Also show size and who deleted each object - This checks each object, one at a time")
+
+	// restore
+
+	trashRestoreCmd.Flags().StringVar(&trashRestoreCmdOpts.S3Key,
+		"s3-key", util.EnvVarString("TRASH_RESTORE_S3_KEY", ""),
+		"(Required) Original key, or key in the trash, to restore")
+
+	trashRestoreCmd.Flags().BoolVar(&trashRestoreCmdOpts.IsDir,
+		"s3-is-dir", util.EnvVarBool("TRASH_RESTORE_S3_IS_DIR", false),
+		"(Optional) Set this option to restore an entire directory")
+
+	trashRestoreCmd.Flags().StringVar(&trashRestoreCmdOpts.DeletedAt,
+		"deleted-at", util.EnvVarString("TRASH_RESTORE_DELETED_AT", ""),
+		"(Optional) Restore from this trash directory, like '2006-01-02T15-04-05.000000000', or every delete in a second with '2006-01-02T15-04-05' - Defaults to the latest delete of each object")
+
+	trashRestoreCmd.Flags().BoolVar(&trashRestoreCmdOpts.Overwrite,
+		"overwrite", util.EnvVarBool("TRASH_RESTORE_OVERWRITE", false),
+		"(Optional) Set this option to replace objects that exist at the original key")
+
+	trashRestoreCmd.Flags().IntVar(&trashRestoreCmdOpts.Workers,
+		"workers", util.EnvVarInt("TRASH_RESTORE_WORKERS", 0),
+		"(Optional) Number of objects to restore at once - Overrides --concurrency, default of 20")
+
+	// purge
+
+	trashPurgeCmd.Flags().StringVar(&trashPurgeCmdOpts.S3Key,
+		"s3-key", util.EnvVarString("TRASH_PURGE_S3_KEY", ""),
+		"(Optional) Original key, or key in the trash, to purge - Defaults to everything")
+
+	trashPurgeCmd.Flags().BoolVar(&trashPurgeCmdOpts.IsDir,
+		"s3-is-dir", util.EnvVarBool("TRASH_PURGE_S3_IS_DIR", false),
+		"(Optional) Set this option to purge an entire directory")
+
+	trashPurgeCmd.Flags().StringVar(&trashPurgeCmdOpts.OlderThan,
+		"older-than", util.EnvVarString("TRASH_PURGE_OLDER_THAN", "720h"),
+		"(Optional) Only purge objects deleted longer ago than this duration, like '720h' - Use '0s' for everything")
+}
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"snapr/util"
+	"strings"
+	"time"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+	"github.com/sirupsen/logrus"
+)
+
+// matchTrashEntries filters trash entries by a key
+// the key can be a key in the trash, or an original key
+// with isDir, everything under the key matches
+func matchTrashEntries(trashDir string, entries []*util.TrashEntry, key string, isDir bool) []*util.TrashEntry {
+	if len(key) == 0 {
+		return entries
+	}
+	if isDir {
+		key = util.EnsureS3DirPath(key)
+	}
+
+	// match on the trash key, or on the original key
+	inTrash := util.IsTrashKey(trashDir, key)
+
+	var matched []*util.TrashEntry
+	for _, entry := range entries {
+		entryKey := entry.OriginalKey
+		if inTrash {
+			entryKey = entry.Object.Key
+		}
+		if entryKey == key || (isDir && strings.HasPrefix(entryKey, key)) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// TrashListCmdRunE runs the trash list command
+// it is exported for testing
+func TrashListCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *TrashListCmdOptions) error {
+	funcTag := "trashList"
+	// logrus.Infof(funcTag)
+	var err error
+
+	// get the storage backend
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		return util.WrapError(err, funcTag, "failed to get storage backend")
+	}
+
+	entries, err := util.ListTrash(ctx, storage, ropts.Bucket, ropts.TrashDir, opts.Long)
+	if err != nil {
+		return util.WrapError(err, funcTag, "failed to list trash")
+	}
+
+	var matched []*util.TrashEntry
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.OriginalKey, opts.S3Key) {
+			matched = append(matched, entry)
+		}
+	}
+
+	switch ropts.Output {
+	case OutputJSON:
+		// always an array, even if empty
+		if matched == nil {
+			matched = []*util.TrashEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(matched)
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to encode trash as json")
+		}
+		return nil
+
+	case OutputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		for _, entry := range matched {
+			err = enc.Encode(entry)
+			if err != nil {
+				return util.WrapError(err, funcTag, "failed to encode trash as ndjson")
+			}
+		}
+		return nil
+	}
+
+	for _, entry := range matched {
+		deletedAt := entry.DeletedAt.Local().Format("2006-01-02 15:04:05")
+		if !opts.Long {
+			fmt.Printf("%s  %s\n", deletedAt, entry.OriginalKey)
+			continue
+		}
+		fmt.Printf("%s  %10s  %-12s  %s  (%s)\n", deletedAt, util.FormatBytes(entry.Object.Size), entry.DeletedBy, entry.OriginalKey, entry.Object.Key)
+	}
+
+	return nil
+}
+
+// TrashRestoreCmdRunE runs the trash restore command
+// it is exported for testing
+func TrashRestoreCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *TrashRestoreCmdOptions) (*util.OperationReport, error) {
+	funcTag := "trashRestore"
+	// logrus.Infof(funcTag)
+	var err error
+
+	// validate required arg
+	if len(opts.S3Key) == 0 {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "option `--s3-key` is required")
+	}
+
+	// validate the trash directory
+	var deletedAt time.Time
+	if len(opts.DeletedAt) > 0 {
+		deletedAt, err = util.ParseTrashTime(opts.DeletedAt)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("option `--deleted-at` must look like %s", util.TrashTimeFormat))
+		}
+	}
+
+	// get the storage backend
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get storage backend")
+	}
+
+	// track what is going on
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	entries, err := util.ListTrash(ctx, storage, ropts.Bucket, ropts.TrashDir, false)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to list trash")
+	}
+
+	// only the newest delete of each original key is restored, unless asked for a specific one
+	// the trash is listed newest first, so the first one seen wins
+	restores := map[string]*util.TrashEntry{}
+	for _, entry := range matchTrashEntries(ropts.TrashDir, entries, opts.S3Key, opts.IsDir) {
+		if !deletedAt.IsZero() && !util.MatchTrashTime(entry.DeletedAt, deletedAt) {
+			continue
+		}
+		if _, ok := restores[entry.OriginalKey]; !ok {
+			restores[entry.OriginalKey] = entry
+		}
+	}
+
+	if len(restores) == 0 {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("nothing in the trash matches: %s", opts.S3Key))
+	}
+
+	if ropts.DryRun {
+		for _, entry := range restores {
+			logrus.Infof("DRY RUN: (restore) %s => %s", entry.Object.Key, entry.OriginalKey)
+		}
+		logrus.Infof("DRY RUN: %d objects", len(restores))
+		return report, report.Finish()
+	}
+
+	// open a new wait group with a maximum number of concurrent workers
+	wg := waitgroup.NewWaitGroup(ropts.workers(opts.Workers, 20))
+
+	for _, entry := range restores {
+		if report.Cancelled(ctx, entry.OriginalKey) {
+			continue
+		}
+
+		// block adding until the next worker has finished
+		wg.BlockAdd()
+
+		go func(entry *util.TrashEntry) {
+			funcTag := "TrashRestoreWorker"
+			defer wg.Done()
+
+			// do not clobber objects that replaced the deleted one
+			var err error
+			if _, headErr := storage.Head(ctx, ropts.Bucket, entry.OriginalKey); headErr == nil && !opts.Overwrite {
+				err = util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("object exists, use `--overwrite` to replace it: %s", entry.OriginalKey))
+			} else {
+				// the restored object gets back its acl, without the trash metadata
+				err = util.RestoreObject(ctx, storage, ropts.Bucket, entry.Object.Key, ropts.Bucket, entry.OriginalKey)
+			}
+
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to restore object: %s", entry.Object.Key))
+				logrus.Warnf(err.Error())
+				report.Fail(entry.OriginalKey, err)
+				return
+			}
+			report.Succeed(entry.OriginalKey, entry.Object.Size)
+			report.AddResult(&TrashRestoreResult{TrashKey: entry.Object.Key, Key: entry.OriginalKey})
+			logrus.Infof("Restored: %s -> %s", entry.Object.Key, entry.OriginalKey)
+		}(entry)
+	}
+
+	// wait on everything to complete
+	wg.Wait()
+
+	err = report.Finish()
+	logrus.Infof("%d objects restored", len(report.Succeeded))
+
+	return report, err
+}
+
+// TrashPurgeCmdRunE runs the trash purge command
+// it is exported for testing
+func TrashPurgeCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *TrashPurgeCmdOptions) (*util.OperationReport, error) {
+	funcTag := "trashPurge"
+	// logrus.Infof(funcTag)
+	var err error
+
+	// validate the age
+	if len(opts.OlderThan) == 0 {
+		opts.OlderThan = "0s"
+	}
+	olderThan, err := time.ParseDuration(opts.OlderThan)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, fmt.Sprintf("option `--older-than` must be a duration, like 720h: %s", opts.OlderThan))
+	}
+	cutoff := time.Now().Add(-olderThan)
+
+	// get the storage backend
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get storage backend")
+	}
+
+	// track what is going on
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	entries, err := util.ListTrash(ctx, storage, ropts.Bucket, ropts.TrashDir, false)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to list trash")
+	}
+
+	var purges []*util.TrashEntry
+	var purgeObjects []*util.S3Object
+	for _, entry := range matchTrashEntries(ropts.TrashDir, entries, opts.S3Key, opts.IsDir) {
+		if entry.DeletedAt.After(cutoff) {
+			continue
+		}
+		purges = append(purges, entry)
+		purgeObjects = append(purgeObjects, entry.Object)
+	}
+
+	if ropts.DryRun {
+		for _, entry := range purges {
+			logrus.Infof("DRY RUN: (purge) %s", entry.Object.Key)
+		}
+		logrus.Infof("DRY RUN: %d objects", len(purges))
+		return report, report.Finish()
+	}
+
+	// ask first, for a lot of objects
+	err = confirmOperation(ropts, "purge", ropts.TrashDir, purgeObjects)
+	if err != nil {
+		return nil, err
+	}
+
+	// delete in batches
+	var keys []string
+	for _, entry := range purges {
+		keys = append(keys, entry.Object.Key)
+	}
+	failed := storage.DeleteMany(ctx, ropts.Bucket, keys)
+	for _, entry := range purges {
+		if err, ok := failed[entry.Object.Key]; ok {
+			report.Fail(entry.Object.Key, err)
+			continue
+		}
+		report.Succeed(entry.Object.Key, entry.Object.Size)
+		logrus.Infof("Purged: %s", entry.Object.Key)
+	}
+
+	err = report.Finish()
+	logrus.Infof("%d objects purged", len(report.Succeeded))
+
+	return report, err
+}
+
+// TrashRestoreResult is an object moved out of the trash
+type TrashRestoreResult struct {
+	TrashKey string `json:"trash_key"`
+	Key      string `json:"key"`
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"snapr/util"
+
+	"github.com/spf13/cobra"
+)
+
+// UndoCmdOptions options
+type UndoCmdOptions struct {
+	ID        string
+	Overwrite bool
+	Workers   int
+}
+
+// undo command
+var (
+	undoCmdOpts = &UndoCmdOptions{}
+	undoCmd     = &cobra.Command{
+		Use:   "undo <operation-id>",
+		Short: "Reverse a rename, copy or delete from the history",
+		Long:  `Renamed and deleted objects are moved back to their original keys, and copies are deleted. Permanent deletes cannot be undone. See "snapr history" for operation ids.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			undoCmdOpts = undoCmdOpts.TransformPositionalArgs(args)
+			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := UndoCmdRunE(ctx, rootCmdOpts, undoCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *UndoCmdOptions) TransformPositionalArgs(args []string) *UndoCmdOptions {
+	if len(args) > 0 && len(opts.ID) == 0 {
+		opts.ID = args[0]
+	}
+	return opts
+}
+
+func init() {
+	// add command to root
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().StringVar(&undoCmdOpts.ID,
+		"id", util.EnvVarString("UNDO_ID", ""),
+		"(Required) Operation to undo, from 'snapr history' - Can also be the first argument")
+
+	undoCmd.Flags().BoolVar(&undoCmdOpts.Overwrite,
+		"overwrite", util.EnvVarBool("UNDO_OVERWRITE", false),
+		"(Optional) Set this option to replace objects that took an original key since")
+
+	// how many at once
+	undoCmd.Flags().IntVar(&undoCmdOpts.Workers,
+		"workers", util.EnvVarInt("UNDO_WORKERS", 0),
+		"(Optional) Number of objects to undo at once - Overrides --concurrency, default of 100")
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"context"
+	"snapr/snapr"
+	"snapr/util"
+)
+
+// UndoCmdRunE runs the undo command
+// it is exported for testing
+func UndoCmdRunE(ctx context.Context, ropts *RootCmdOptions, opts *UndoCmdOptions) (*util.OperationReport, error) {
+	funcTag := "undo"
+
+	client, err := newClient(ropts)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get client")
+	}
+
+	result, err := client.Undo(ctx, snapr.UndoOptions(*opts))
+	if result == nil {
+		return nil, err
+	}
+	return result.Report, err
+}
@@ -15,6 +15,7 @@ type UploadCmdOptions struct {
 	UploadLimit         int
 	S3Dir               string
 	Public              bool
+	Workers             int
 }
 
 // upload command
@@ -26,8 +27,13 @@ var (
 		Long:  `Do you like turtles?`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			uploadCmdOpts = uploadCmdOpts.TransformPositionalArgs(args)
+			// the config profile can set the default prefixes
+			envDefault(cmd, "s3-dir", "UPLOAD_S3_DIR", &uploadCmdOpts.S3Dir)
 			rootCmdOpts = rootCmdOpts.SetupS3ConfigFromRootArgs()
-			return UploadCmdRunE(rootCmdOpts, uploadCmdOpts)
+			ctx, cancel := commandContext(rootCmdOpts)
+			defer cancel()
+			report, err := UploadCmdRunE(ctx, rootCmdOpts, uploadCmdOpts)
+			return writeOperationReport(rootCmdOpts, report, err)
 		},
 	}
 )
@@ -81,4 +87,9 @@ func init() {
 	uploadCmd.Flags().BoolVar(&uploadCmdOpts.Public,
 		"s3-is-public", util.EnvVarBool("UPLOAD_S3_IS_PUBLIC", false),
 		"(Optional) Use this to upload a publicly available file, otherwise its private. Requires a public S3!")
+
+	// how many at once
+	uploadCmd.Flags().IntVar(&uploadCmdOpts.Workers,
+		"workers", util.EnvVarInt("UPLOAD_WORKERS", 0),
+		"(Optional) Number of objects to upload at once - Overrides --concurrency, default of 1")
 }
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// VersionCmdOptions options
+type VersionCmdOptions struct {
+}
+
+// version command
+var (
+	versionCmdOpts = &VersionCmdOptions{}
+	versionCmd     = &cobra.Command{
+		Use:   "version",
+		Short: "Print the version, commit, build date, build mode, Go version and platform",
+		// the version always prints, even when the config does not load
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			rootCmdOpts.Output = rootCmdOpts.outputOrEnv()
+			return rootCmdOpts.ValidateOutput()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			versionCmdOpts = versionCmdOpts.TransformPositionalArgs(args)
+			return VersionCmdRunE(rootCmdOpts, versionCmdOpts)
+		},
+	}
+)
+
+// TransformPositionalArgs adds the positional string args
+// from the command to the options struct (for DI)
+// care should be taken to not use the same options here as in flags, etc
+func (opts *VersionCmdOptions) TransformPositionalArgs(args []string) *VersionCmdOptions {
+	return opts
+}
+
+func init() {
+	// add command to root
+	rootCmd.AddCommand(versionCmd)
+}
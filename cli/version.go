@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"snapr/util"
+)
+
+// VersionCmdRunE runs the version command
+// it is exported for testing
+func VersionCmdRunE(ropts *RootCmdOptions, opts *VersionCmdOptions) error {
+	funcTag := "version"
+
+	info := util.GetVersionInfo()
+
+	switch ropts.Output {
+	case OutputJSON, OutputNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		if ropts.Output == OutputJSON {
+			enc.SetIndent("", "  ")
+		}
+		err := enc.Encode(info)
+		if err != nil {
+			return util.WrapError(err, funcTag, "failed to encode version as json")
+		}
+		return nil
+	}
+
+	fmt.Printf("Version:    %s\n", info.Version)
+	fmt.Printf("Commit:     %s\n", info.Commit)
+	fmt.Printf("Build date: %s\n", info.BuildDate)
+	fmt.Printf("Build mode: %s\n", info.BuildMode)
+	fmt.Printf("Go version: %s\n", info.GoVersion)
+	fmt.Printf("Platform:   %s/%s\n", info.OS, info.Arch)
+
+	return nil
+}
+
+// setupVersionFlag adds `--version` to the root command
+// the version is only known once the compiled-in .env is loaded
+func setupVersionFlag() {
+	info := util.GetVersionInfo()
+	rootCmd.Version = info.Version
+	rootCmd.SetVersionTemplate(info.String() + "\n")
+}
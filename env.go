@@ -2,6 +2,7 @@ package main
 
 import (
 	"io/ioutil"
+	"os"
 	"snapr/util"
 	"strings"
 
@@ -42,8 +43,21 @@ func LoadEnv() (err error) {
 
 	// apply env
 	// used this lib because it is loadable from string
+	// snapr settings are kept apart from the env, so that the env and a config profile can go before them,
+	// and so that a prod build can keep them
+	// anything else, like AWS_* vars, is applied to the env when not already set
 	logrus.Infof("Applying environment")
-	gotenv.Apply(strings.NewReader(envString))
+	compiledIn := map[string]string{}
+	for key, value := range gotenv.Parse(strings.NewReader(envString)) {
+		if util.IsEnvVarName(key) {
+			compiledIn[key] = value
+			continue
+		}
+		if _, ok := os.LookupEnv(key); !ok {
+			os.Setenv(key, value)
+		}
+	}
+	util.SetCompiledInEnv(compiledIn)
 	// logrus.Infof(os.Getenv("SNAPR_VERSION"))
 
 	return nil
@@ -4,7 +4,7 @@ go 1.13
 
 require (
 	github.com/BurntSushi/xgb v0.0.0-20160522181843-27f122750802 // indirect
-	github.com/aws/aws-sdk-go v1.15.77
+	github.com/aws/aws-sdk-go v1.26.8
 	github.com/disintegration/imaging v1.6.2
 	github.com/gen2brain/shm v0.0.0-20191025110947-b09d223a76f1 // indirect
 	github.com/kbinani/screenshot v0.0.0-20191211154542-3a185f1ce18f
@@ -14,10 +14,11 @@ require (
 	github.com/pieterclaerhout/go-waitgroup v1.0.6
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/spf13/pflag v1.0.5
 	github.com/subosito/gotenv v1.2.0
 	golang.org/x/image v0.0.0-20191214001246-9130b4cfad52 // indirect
 	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
 	golang.org/x/sys v0.0.0-20191210023423-ac6580df4449 // indirect
+	gopkg.in/yaml.v2 v2.2.7
 )
@@ -4,12 +4,19 @@ import (
 	"os"
 	"runtime"
 	"snapr/cli"
+	"snapr/util"
 
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
 
+	// stdout is for results, like with "--output=json"
+	logrus.SetOutput(os.Stderr)
+
+	// prod builds do not log debugging details
+	logrus.SetLevel(util.Build.LogLevel)
+
 	// log the runtime OS code
 	logrus.Infof("OS: %s", runtime.GOOS)
 
@@ -24,8 +31,10 @@ func main() {
 	if err != nil {
 		// warn for visibility
 		logrus.Warnf(err.Error())
-		// exit with status 0 for PAM
-		// would normally use code 1
-		os.Exit(0)
+		// PAM treats a non-zero status as a failed login
+		if cli.IsPAMMode() {
+			os.Exit(0)
+		}
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,85 @@
+// Package snapr is the library behind the snapr cli
+// it uploads, downloads, deletes, renames, processes and searches objects in a bucket
+// without logging to the global logger, so that it can be embedded in other services
+package snapr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"snapr/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Client runs operations against a single bucket in a storage backend
+type Client struct {
+	Storage util.Storage
+	Bucket  string
+
+	// deleted objects are moved under this key, unless deleted permanently
+	TrashDir string
+	// DryRun logs what would be changed, without changing anything
+	DryRun bool
+	// Confirm is asked before changing many objects, and cancels by returning an error
+	// when nil, nothing is asked
+	Confirm func(action, key string, objects []*util.S3Object) error
+	// Log is where the client, its storage backend and its retries log to, and discards by default
+	Log logrus.FieldLogger
+	// JournalDir is where directory operations keep a journal, to resume them from
+	// when empty, no journal is kept
+	JournalDir string
+	// History is where renames, copies and deletes are recorded, to undo them from
+	// when nil, nothing is recorded
+	History *util.History
+	// Concurrency is how many objects every operation works on at once
+	// when 0, each operation uses its own default
+	Concurrency int
+}
+
+// NewClient gets a client for the bucket in the accessor
+// when storage is nil, the backend is picked from the accessor, like the cli does
+func NewClient(config *util.S3Accessor, storage util.Storage) (*Client, error) {
+	funcTag := "NewClient"
+
+	if config == nil {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "accessor cannot be nil")
+	}
+
+	if storage == nil {
+		var err error
+		storage, err = util.NewStorage(config)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to get storage backend")
+		}
+	}
+
+	discard := logrus.New()
+	discard.SetOutput(ioutil.Discard)
+
+	return &Client{
+		Storage:  storage,
+		Bucket:   config.Bucket,
+		TrashDir: ".trash",
+		Log:      discard,
+	}, nil
+}
+
+// confirm asks before changing many objects, if the client is set up to ask
+func (c *Client) confirm(action, key string, objects []*util.S3Object) error {
+	if c.Confirm == nil || c.DryRun {
+		return nil
+	}
+	return c.Confirm(action, key, objects)
+}
+
+// workers gets how many objects an operation works on at once
+// the operation's own setting comes first, then the client's, then the operation's default
+func (c *Client) workers(workers, defaultWorkers int) int {
+	if workers > 0 {
+		return workers
+	}
+	if c.Concurrency > 0 {
+		return c.Concurrency
+	}
+	return defaultWorkers
+}
@@ -0,0 +1,284 @@
+package snapr
+
+import (
+	"context"
+	"fmt"
+	"snapr/util"
+	"sync"
+	"time"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Delete moves an object, or all the objects under a directory key, to the trash
+// or deletes them permanently
+func (c *Client) Delete(ctx context.Context, opts DeleteOptions) (result *DeleteResult, err error) {
+	funcTag := "delete"
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// keep track of directory deletes, or pick up where one stopped
+	journal, err := c.startJournal(funcTag, opts.Resume, opts.IsDir, &opts, opts.validate)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to set up journal")
+	}
+	defer func() { c.endJournal(journal, err) }()
+
+	// track operated object keys
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	// everything deleted together goes into the same trash directory, so it can be restored together
+	// objects that are already in the trash can only be deleted permanently
+	// a resumed delete goes into the same trash directory as the run that it continues
+	deletedAt := time.Now()
+	if journal != nil {
+		deletedAt = journal.Started
+	}
+	deletedBy := util.CurrentUser()
+	deleteObject := func(key string) (string, error) {
+		if opts.Permanent || util.IsTrashKey(c.TrashDir, key) {
+			return "", c.Storage.Delete(ctx, c.Bucket, key)
+		}
+		return util.TrashObject(ctx, c.Storage, c.Bucket, c.TrashDir, key, deletedBy, deletedAt)
+	}
+
+	// dry runs show where everything would go
+	dryRunObject := func(key string) {
+		if opts.Permanent || util.IsTrashKey(c.TrashDir, key) {
+			c.Log.Infof("DRY RUN: (delete) %s", key)
+			return
+		}
+		c.Log.Infof("DRY RUN: (trash) %s => %s", key, util.TrashKey(c.TrashDir, deletedAt, key))
+	}
+
+	if !opts.IsDir {
+
+		// file
+		file := util.S3Object{Key: opts.S3Key}
+
+		// check if the objct exists
+		head, err := c.Storage.Head(ctx, c.Bucket, file.Key)
+		if err != nil {
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("failed to confirm object existence, or object does not exist in bucket: '%s/%s'", c.Bucket, file.Key))
+		}
+		// c.Log.Infof("Object exists: %s", file.Key)
+
+		if c.DryRun {
+			dryRunObject(file.Key)
+			return newDeleteResult(report), report.Finish()
+		}
+
+		// delete the object from storage, or move it to the trash
+		trashKey, err := deleteObject(file.Key)
+		if err != nil {
+			err = util.WrapError(err, funcTag, fmt.Sprintf("failed to delete object: %s", file.Key))
+			report.Fail(file.Key, err)
+			return newDeleteResult(report), err
+		}
+
+		report.Succeed(file.Key, head.Size)
+		report.AddResult(&DeletedObject{Key: file.Key, TrashKey: trashKey, Size: head.Size})
+		if len(trashKey) > 0 {
+			c.Log.Infof("Trashed: %s -> %s", file.Key, trashKey)
+		} else {
+			c.Log.Infof("Deleted: %s", file.Key)
+		}
+	} else {
+
+		// ensure ending dir slash for all these
+		opts.S3Key = util.EnsureS3DirPath(opts.S3Key)
+
+		// get all the objects in the bucket
+		listed, _, err := c.Storage.List(ctx, c.Bucket, opts.S3Key, false)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to get a list bucket objects for key: %s", opts.S3Key))
+		}
+
+		// leave the trash alone, unless deleting permanently
+		var objects []*util.S3Object
+		for _, object := range listed {
+			if !opts.Permanent && util.IsTrashKey(c.TrashDir, object.Key) {
+				continue
+			}
+			objects = append(objects, object)
+		}
+
+		// leave out what was done before, when resuming
+		objects, err = c.plan(journal, objects)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to record objects to delete")
+		}
+
+		if c.DryRun {
+			for _, object := range objects {
+				dryRunObject(object.Key)
+			}
+			c.Log.Infof("DRY RUN: %d objects", len(objects))
+			return newDeleteResult(report), report.Finish()
+		}
+
+		// ask first, for a lot of objects
+		err = c.confirm("delete", opts.S3Key, objects)
+		if err != nil {
+			return nil, err
+		}
+
+		// track failed keys, and why
+		// and the keys that were not started, once cancelled
+		failed := map[string]error{}
+		skipped := map[string]bool{}
+		var mutex sync.Mutex
+
+		// the keys to delete in batches
+		var keys []string
+		if opts.Permanent {
+			for _, object := range objects {
+				if report.Cancelled(ctx, object.Key) {
+					skipped[object.Key] = true
+					continue
+				}
+				keys = append(keys, object.Key)
+			}
+		} else {
+			// there is no batch copy, so objects are copied to the trash one at a time
+			// only the ones that made it to the trash get deleted
+
+			// open a new wait group with a maximum number of concurrent workers
+			wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 100))
+
+			for _, object := range objects {
+
+				// stop starting new copies once cancelled
+				if report.Cancelled(ctx, object.Key) {
+					skipped[object.Key] = true
+					continue
+				}
+
+				// block adding until the next worker has finished
+				wg.BlockAdd()
+
+				go func(key string) {
+					funcTag := "TrashObjectWorker"
+					defer wg.Done()
+
+					_, err := util.CopyToTrash(ctx, c.Storage, c.Bucket, c.TrashDir, key, deletedBy, deletedAt)
+
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					if err != nil {
+						failed[key] = util.WrapError(err, funcTag, fmt.Sprintf("failed to move object to trash: %s", key))
+						return
+					}
+					keys = append(keys, key)
+				}(object.Key)
+			}
+
+			// wait on everything to complete
+			wg.Wait()
+		}
+
+		// delete in batches
+		for key, err := range c.Storage.DeleteMany(ctx, c.Bucket, keys) {
+			failed[key] = err
+		}
+
+		// track what was deleted
+		for _, object := range objects {
+			if skipped[object.Key] {
+				continue
+			}
+			if err, ok := failed[object.Key]; ok {
+				report.Fail(object.Key, err)
+				continue
+			}
+			c.done(journal, object.Key)
+			report.Succeed(object.Key, object.Size)
+			deleted := &DeletedObject{Key: object.Key, Size: object.Size}
+			if !opts.Permanent {
+				deleted.TrashKey = util.TrashKey(c.TrashDir, deletedAt, object.Key)
+			}
+			report.AddResult(deleted)
+		}
+
+		if len(failed) > 0 {
+			c.Log.Warnf("%d of %d objects failed to delete from %s", len(failed), len(objects), opts.S3Key)
+		} else if opts.Permanent {
+			c.Log.Infof("Deleted all objects from %s", opts.S3Key)
+		} else {
+			c.Log.Infof("Trashed all objects from %s to %s", opts.S3Key, util.TrashKey(c.TrashDir, deletedAt, opts.S3Key))
+		}
+	}
+
+	err = report.Finish()
+	c.Log.Infof("%d objects deleted", len(report.Succeeded))
+
+	// record what went to the trash, so it can be undone
+	// permanent deletes cannot be undone, so there is nothing to record for them
+	result = newDeleteResult(report)
+	var moves []*util.HistoryMove
+	for _, deleted := range result.Deleted {
+		if len(deleted.TrashKey) == 0 {
+			continue
+		}
+		moves = append(moves, &util.HistoryMove{
+			SrcBucket:  c.Bucket,
+			SrcKey:     deleted.Key,
+			DestBucket: c.Bucket,
+			DestKey:    deleted.TrashKey,
+			Size:       deleted.Size,
+		})
+	}
+	result.HistoryID = c.record(util.HistoryDelete, opts.S3Key, moves)
+
+	return result, err
+}
+
+// DeleteOptions are the options for Delete
+type DeleteOptions struct {
+	S3Key     string
+	IsDir     bool
+	Permanent bool
+	// Resume is a journal to continue a directory delete from
+	Resume string `json:"-"`
+	// Workers is how many objects are deleted at once, over the client Concurrency
+	Workers int `json:"-"`
+}
+
+// validate checks the options of a delete
+func (opts *DeleteOptions) validate() error {
+	funcTag := "delete"
+
+	// validate required arg
+	if len(opts.S3Key) == 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, "option `--s3-key` is required")
+	}
+
+	return nil
+}
+
+// DeletedObject is a deleted object, and where it went in the trash, if anywhere
+type DeletedObject struct {
+	Key      string `json:"key"`
+	TrashKey string `json:"trash_key,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// DeleteResult is what Delete did
+type DeleteResult struct {
+	Report  *util.OperationReport
+	Deleted []*DeletedObject
+	// HistoryID is the history entry to undo this with, if one was recorded
+	HistoryID string
+}
+
+// newDeleteResult gets the typed result from the report
+func newDeleteResult(report *util.OperationReport) *DeleteResult {
+	result := &DeleteResult{Report: report}
+	for _, r := range report.Results {
+		result.Deleted = append(result.Deleted, r.(*DeletedObject))
+	}
+	return result
+}
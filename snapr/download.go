@@ -0,0 +1,184 @@
+package snapr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"snapr/util"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Download downloads an object, or all the objects under a directory key
+func (c *Client) Download(ctx context.Context, opts DownloadOptions) (result *DownloadResult, err error) {
+	funcTag := "download"
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// not validating the dir here, because you might want to download the entire dir ("")
+
+	// default the out dir if empty
+	if len(opts.OutDir) == 0 {
+		// default to the directory where the binary exists (pwd)
+		opts.OutDir, err = os.Getwd()
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to get pwd for output")
+		}
+	}
+
+	// a resumed download writes to the same place, from wherever it is resumed
+	opts.OutDir, err = filepath.Abs(opts.OutDir)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, fmt.Sprintf("cannot get abs path for output: %s", opts.OutDir))
+	}
+
+	// keep track of directory downloads, or pick up where one stopped
+	journal, err := c.startJournal(funcTag, opts.Resume, opts.IsDir, &opts, nil)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to set up journal")
+	}
+	defer func() { c.endJournal(journal, err) }()
+
+	c.Log.Infof("KEY: %s, OUT: %s", opts.S3Key, opts.OutDir)
+
+	// track operated object keys
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	if !opts.IsDir {
+
+		// file
+		absFilePath := filepath.Join(opts.OutDir, opts.S3Key)
+		object := util.S3Object{Key: opts.S3Key}
+
+		// check if the objct exists
+		head, err := c.Storage.Head(ctx, c.Bucket, object.Key)
+		if err != nil {
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("failed to confirm object existence, or object does not exist in bucket: '%s/%s'", c.Bucket, object.Key))
+		}
+		// c.Log.Infof("Object exists: %s", file.Key)
+
+		// stream the object to the file
+		err = c.Storage.Download(ctx, c.Bucket, object.Key, absFilePath)
+		if err != nil {
+			err = util.WrapError(err, funcTag, fmt.Sprintf("failed to download object: %s", object.Key))
+			report.Fail(object.Key, err)
+			return newDownloadResult(report), err
+		}
+
+		// track
+		report.Succeed(object.Key, head.Size)
+		report.AddResult(&DownloadedObject{
+			Key:   object.Key,
+			Path:  absFilePath,
+			Bytes: head.Size,
+		})
+		c.Log.Infof("Downloaded %s to %s", object.Key, absFilePath)
+	} else {
+
+		// ensure ending dir slash for all these
+		opts.S3Key = util.EnsureS3DirPath(opts.S3Key)
+
+		// get all the objects in the bucket
+		objects, _, err := c.Storage.List(ctx, c.Bucket, opts.S3Key, false)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to get a list bucket objects for key: %s", opts.S3Key))
+		}
+
+		// leave out what was done before, when resuming
+		objects, err = c.plan(journal, objects)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to record objects to download")
+		}
+
+		// open a new wait group with a maximum number of concurrent workers
+		wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 50))
+
+		// loop through all objects and spawn goroutines to wait for
+		for _, object := range objects {
+			if report.Cancelled(ctx, object.Key) {
+				continue
+			}
+
+			// block adding until the next worker has finished
+			wg.BlockAdd()
+
+			// file
+			absFilePath := filepath.Join(opts.OutDir, object.Key)
+
+			// c.Log.Infof("KEY: %s", object.Key)
+
+			// on a separate goroutine, do something asyncronous
+			// download, write, accumulate
+			go func(object *util.S3Object, absFilePath string) {
+				funcTag := "DownloadObjectWorker"
+				defer wg.Done()
+
+				// stream the object to the file
+				err := c.Storage.Download(ctx, c.Bucket, object.Key, absFilePath)
+				if err != nil {
+					err = util.WrapError(err, funcTag, fmt.Sprintf("failed to download object: %s", object.Key))
+					c.Log.Warnf(err.Error())
+					report.Fail(object.Key, err)
+					return
+				}
+
+				// add to tracker
+				c.done(journal, object.Key)
+				report.Succeed(object.Key, object.Size)
+				report.AddResult(&DownloadedObject{
+					Key:   object.Key,
+					Path:  absFilePath,
+					Bytes: object.Size,
+				})
+
+				// we need these
+			}(object, absFilePath)
+		}
+
+		// wait on everything to complete
+		wg.Wait()
+
+		c.Log.Infof("Downloaded all objects from %s", opts.S3Key)
+	}
+
+	err = report.Finish()
+	c.Log.Infof("%d objects downloaded", len(report.Succeeded))
+
+	return newDownloadResult(report), err
+}
+
+// DownloadOptions are the options for Download
+type DownloadOptions struct {
+	S3Key  string
+	IsDir  bool
+	OutDir string
+	// Resume is a journal to continue a directory download from
+	Resume string `json:"-"`
+	// Workers is how many objects are downloaded at once, over the client Concurrency
+	Workers int `json:"-"`
+}
+
+// DownloadedObject is a downloaded object
+type DownloadedObject struct {
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DownloadResult is what Download did
+type DownloadResult struct {
+	Report     *util.OperationReport
+	Downloaded []*DownloadedObject
+}
+
+// newDownloadResult gets the typed result from the report
+func newDownloadResult(report *util.OperationReport) *DownloadResult {
+	result := &DownloadResult{Report: report}
+	for _, r := range report.Results {
+		result.Downloaded = append(result.Downloaded, r.(*DownloadedObject))
+	}
+	return result
+}
@@ -0,0 +1,285 @@
+package snapr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"snapr/util"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Grep searches the objects under a directory key, or a single object, for a pattern
+func (c *Client) Grep(ctx context.Context, opts GrepOptions) (*GrepResult, error) {
+	funcTag := "grep"
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// ------  DEFAULTS -----------------------------------
+
+	// ensure ending dir slash for all these
+	opts.S3Dir = util.EnsureS3DirPath(opts.S3Dir)
+
+	// if there is a file specified, append it to the dir
+	if len(opts.S3Key) > 0 {
+		opts.S3Dir = util.JoinS3Path(opts.S3Dir, opts.S3Key)
+	}
+
+	// if literal, wrap the regex pattern
+	if opts.SearchIsLiteral {
+		opts.SearchPattern = "\\b" + opts.SearchPattern + "\\b"
+	}
+
+	// ------  VALIDATE -----------------------------------
+
+	// validate the in dir
+	if len(opts.S3Dir) == 0 {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "must provide a value for `--s3-dir`")
+	}
+
+	// validate the out dir
+	if len(opts.SearchPattern) == 0 {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "must provide a value for `--pattern`")
+	}
+
+	// compile regex
+	reggy, err := regexp.Compile(opts.SearchPattern)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to compile search pattern")
+	}
+
+	// parse the date window, if any
+	var since, until time.Time
+	if len(opts.Since) > 0 {
+		since, err = util.ParseTimeInput(opts.Since)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "invalid value for `--since`")
+		}
+	}
+	if len(opts.Until) > 0 {
+		until, err = util.ParseTimeInput(opts.Until)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "invalid value for `--until`")
+		}
+	}
+
+	c.Log.Infof("IN: %s, OUT: %s, PATTERN: %s", opts.S3Dir, opts.OutDir, opts.SearchPattern)
+
+	// track what is going on
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	// ------  LIST OBJECTS -----------------------------------
+
+	// list all SOURCE files recursively
+	// for the directory to process from ("originals")
+	objects, _, err := c.Storage.List(ctx, c.Bucket, opts.S3Dir, false)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get src s3 object list")
+	}
+
+	// filter by the date window
+	var objectsToProcess []*util.S3Object
+	for _, object := range objects {
+		if !since.IsZero() && object.LastModified.Before(since) {
+			continue
+		}
+		if !until.IsZero() && !object.LastModified.Before(until) {
+			continue
+		}
+		objectsToProcess = append(objectsToProcess, object)
+	}
+	c.Log.Infof("FILES TO SEARCH: %d", len(objectsToProcess))
+
+	// open a new wait group with a maximum number of concurrent workers
+	wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 30))
+
+	// accumulate results
+	var mutex sync.Mutex
+	resultTracker := &[]*GrepResultChunk{}
+
+	// loop through all objects and spawn goroutines to wait for
+	for _, object := range objectsToProcess {
+		if report.Cancelled(ctx, object.Key) {
+			continue
+		}
+
+		// block adding until the next worker has finished
+		wg.BlockAdd()
+
+		// on a separate goroutine, do something asyncronous
+		// download, search, accumulate
+		go func(searchObj *util.S3Object, accumulator *[]*GrepResultChunk) {
+			funcTag := "GrepSearchWorker"
+			defer wg.Done()
+
+			c.Log.Infof("SEARCH KEY: %s", searchObj.Key)
+
+			// download the original file
+			dlBytes, err := c.Storage.Get(ctx, c.Bucket, searchObj.Key)
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to download bucket object: %s", searchObj.Key))
+				c.Log.Warnf(err.Error())
+				report.Fail(searchObj.Key, err)
+				return
+			}
+
+			// encode for escape chars
+			buf := new(bytes.Buffer)
+			enc := json.NewEncoder(buf)
+			enc.SetEscapeHTML(false)
+			err = enc.Encode(string(dlBytes))
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to convert downloaded bytes to string: %s", searchObj.Key))
+				c.Log.Warnf(err.Error())
+				report.Fail(searchObj.Key, err)
+				return
+			}
+			c.Log.Infof("LENGTH: %d, KEY: %s", buf.Len(), searchObj.Key)
+
+			// open a new scanner
+			scanr := bufio.NewScanner(buf)
+			// scanr := bufio.NewScanner(strings.NewReader(buf.String()))
+
+			// use a custom split method and buffer
+			scanrBufLimit := 1024 * 1024
+			scanrBuf := make([]byte, 0, scanrBufLimit)
+			scanr.Buffer(scanrBuf, 10*scanrBufLimit)
+
+			// scan lines (not words or other)
+			// in our case, we have one HUGE line
+			scanr.Split(bufio.ScanLines)
+
+			// scan and search
+			lineCounter := 0
+			lineMatchCounter := 0
+			matchCounter := 0
+			for scanr.Scan() {
+
+				// tick the line counter
+				lineCounter++
+
+				// scan the line
+				line := scanr.Text()
+				// c.Log.Infof("LINE: %d, LEN: %d", lineCounter, len(line))
+
+				// if matches, look closer
+				if reggy.MatchString(line) {
+
+					// reset counters
+					lineMatchCounter++
+
+					// check for sub matches in the line
+					results := reggy.FindAllStringIndex(line, -1)
+					for _, r := range results {
+						matchCounter++
+
+						// raw indexes and text
+						startIdx := r[0]
+						endIdx := r[1]
+						rawText := line[startIdx:endIdx]
+
+						// display x chars before and after each match
+						displayOffset := 50
+						displayStart := 0
+						if startIdx > displayOffset {
+							displayStart = startIdx - displayOffset
+						}
+						displayEnd := len(line) - 1
+						if endIdx < len(line)-1-displayOffset {
+							displayEnd = endIdx + displayOffset
+						}
+						displayText := line[displayStart:displayEnd]
+
+						// truncation
+						truncLength := opts.TruncationLimit
+						var truncTexts []string
+
+						// if less than max, just return that
+						if len(rawText) <= truncLength {
+							truncTexts = append(truncTexts, rawText)
+						} else {
+							// if length is longer than max, show beginning and ending with ... in middle
+							truncTexts = append(truncTexts, line[startIdx:startIdx+(truncLength/2)])
+							truncTexts = append(truncTexts, line[(endIdx-(truncLength/2)):endIdx])
+						}
+
+						// c.Log.Infof("(MATCH %d) Line: %d, Start: %d, End: %d", matchCounter, lineCounter, startIdx, endIdx)
+						//c.Log.Infof("MATCH: %s", line[displayStart:displayEnd])
+
+						mutex.Lock()
+						*accumulator = append(*accumulator, &GrepResultChunk{
+							S3Object:      searchObj,
+							Key:           searchObj.Key,
+							LineNumber:    lineCounter,
+							StartIndex:    startIdx,
+							EndIndex:      endIdx,
+							RawText:       rawText,
+							DisplayText:   displayText,
+							TruncatedText: strings.Join(truncTexts, " ... "),
+						})
+						mutex.Unlock()
+					}
+				}
+			}
+
+			// track
+			report.Succeed(searchObj.Key, int64(len(dlBytes)))
+
+			// we need these injected here
+		}(object, resultTracker)
+	}
+
+	// wait on everything to complete
+	wg.Wait()
+
+	// further filters or scoring systems?
+
+	c.Log.Infof("FOUND: %d", len(*resultTracker))
+
+	for _, r := range *resultTracker {
+		report.AddResult(r)
+	}
+
+	err = report.Finish()
+	return &GrepResult{Report: report, Matches: *resultTracker}, err
+}
+
+// GrepOptions are the options for Grep
+type GrepOptions struct {
+	S3Key           string
+	S3Dir           string
+	OutDir          string
+	SearchPattern   string
+	SearchIsLiteral bool
+	TruncationLimit int
+	Since           string
+	Until           string
+	// Workers is how many objects are searched at once, over the client Concurrency
+	Workers int
+}
+
+// GrepResult is what Grep found
+type GrepResult struct {
+	Report  *util.OperationReport
+	Matches []*GrepResultChunk
+}
+
+// GrepResultChunk holds a reference to everything we need to identify a match
+type GrepResultChunk struct {
+	S3Object      *util.S3Object `json:"-"`
+	Key           string         `json:"key"`
+	LineNumber    int            `json:"line_number"`
+	StartIndex    int            `json:"start_index"`
+	EndIndex      int            `json:"end_index"`
+	DisplayText   string         `json:"display_text"`
+	TruncatedText string         `json:"truncated_text"`
+	RawText       string         `json:"raw_text"`
+}
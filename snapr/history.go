@@ -0,0 +1,26 @@
+package snapr
+
+import (
+	"context"
+	"snapr/util"
+)
+
+// record keeps what an operation moved in the history, so that it can be undone, and returns its id
+// dry runs and operations that moved nothing are not recorded
+// the history is what is left to undo a stopped run with, so it is saved even once the context is done
+// failing to save it does not undo the operation, so this only warns
+func (c *Client) record(operation, key string, moves []*util.HistoryMove) string {
+	if c.History == nil || c.DryRun || len(moves) == 0 {
+		return ""
+	}
+
+	entry := util.NewHistoryEntry(operation, c.Bucket, key, moves)
+	err := c.History.Save(context.Background(), entry)
+	if err != nil {
+		c.Log.Warnf(err.Error())
+		return ""
+	}
+	c.Log.Infof("HISTORY: %s - Undo with `snapr undo %s`", entry.ID, entry.ID)
+
+	return entry.ID
+}
@@ -0,0 +1,117 @@
+package snapr
+
+import (
+	"encoding/json"
+	"fmt"
+	"snapr/util"
+)
+
+// startJournal opens the journal to resume, and loads the options that the operation was started with
+// or starts a new journal in the journal dir, for directory operations
+// the journal keeps only the options that define the plan, so the workers given to a resumed run are kept
+// the options are validated once they are loaded, and before a new journal is started, so that an invalid operation leaves none behind
+// it returns nil when there is no journal to keep
+func (c *Client) startJournal(operation, resume string, isDir bool, opts interface{}, validate func() error) (*util.Journal, error) {
+	funcTag := "startJournal"
+
+	// some operations have nothing to validate
+	if validate == nil {
+		validate = func() error { return nil }
+	}
+
+	if len(resume) > 0 {
+		journal, err := util.OpenJournal(resume, operation)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to open journal to resume")
+		}
+
+		// the same keys in another bucket are not the same operation
+		if journal.Bucket != c.Bucket {
+			journal.Close(false)
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("journal is for bucket '%s', not '%s': %s", journal.Bucket, c.Bucket, resume))
+		}
+
+		err = json.Unmarshal(journal.Options, opts)
+		if err != nil {
+			journal.Close(false)
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to read options from journal: %s", resume))
+		}
+		if err := validate(); err != nil {
+			journal.Close(false)
+			return nil, err
+		}
+
+		c.Log.Infof("RESUMING: %s", resume)
+		return journal, nil
+	}
+
+	if err := validate(); err != nil {
+		return nil, err
+	}
+
+	// single objects are done in one go, and dry runs change nothing
+	if !isDir || c.DryRun || len(c.JournalDir) == 0 {
+		return nil, nil
+	}
+
+	journal, err := util.NewJournal(c.JournalDir, operation, c.Bucket, opts)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to start journal")
+	}
+	c.Log.Infof("JOURNAL: %s", journal.Path)
+
+	return journal, nil
+}
+
+// plan records the objects to operate on in the journal, and gets the ones that are not done yet
+// when resuming, these are the ones left over from the earlier run
+func (c *Client) plan(journal *util.Journal, objects []*util.S3Object) ([]*util.S3Object, error) {
+	funcTag := "plan"
+
+	// dry runs do not write to the journal
+	if journal == nil || (c.DryRun && !journal.HasPlan()) {
+		return objects, nil
+	}
+
+	remaining, err := journal.Plan(objects)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to plan")
+	}
+
+	done, planned := journal.Progress()
+	if done > 0 {
+		c.Log.Infof("RESUMING: %d of %d already done", done, planned)
+	}
+
+	return remaining, nil
+}
+
+// done records a finished key in the journal, if any
+// the key itself is finished either way, so this only warns
+func (c *Client) done(journal *util.Journal, key string) {
+	if c.DryRun {
+		return
+	}
+	err := journal.Done(key)
+	if err != nil {
+		c.Log.Warnf(err.Error())
+	}
+}
+
+// endJournal closes the journal
+// it is removed when the operation finished everything, and kept to resume from otherwise
+func (c *Client) endJournal(journal *util.Journal, err error) {
+	if journal == nil {
+		return
+	}
+
+	closeErr := journal.Close(err == nil && !c.DryRun)
+	if closeErr != nil {
+		c.Log.Warnf(closeErr.Error())
+		return
+	}
+
+	if err != nil {
+		c.Log.Warnf("Continue where this stopped with `--resume=%s`", journal.Path)
+	}
+}
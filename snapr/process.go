@@ -0,0 +1,444 @@
+package snapr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"path/filepath"
+	"snapr/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Process resizes new or changed originals under the source key into one directory per size under the destination key
+// or all of them, when rebuilding all
+func (c *Client) Process(ctx context.Context, opts ProcessOptions) (result *ProcessResult, err error) {
+	funcTag := "process"
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// keep track of the originals processed, or pick up where an earlier run stopped
+	journal, err := c.startJournal(funcTag, opts.Resume, true, &opts, opts.validate)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to set up journal")
+	}
+	defer func() { c.endJournal(journal, err) }()
+
+	// ------  DEFAULT -----------------------------------
+
+	// set the object acl to "private"
+	acl := "private"
+	// unless set to public
+	if opts.IsDestPublic {
+		acl = "public-read"
+	}
+	c.Log.Infof("With Access ACL: %s", acl)
+
+	// default to RebuildNew if neither is set
+	if !opts.RebuildAll && !opts.RebuildNew {
+		opts.RebuildAll = false
+		opts.RebuildNew = true
+	}
+
+	// default to RebuildNew if both are set
+	if opts.RebuildAll && opts.RebuildNew {
+		opts.RebuildAll = false
+		opts.RebuildNew = true
+	}
+
+	// ensure ending dir slash for all these
+	opts.S3SrcKey = util.EnsureS3DirPath(opts.S3SrcKey)
+	opts.S3DestKey = util.EnsureS3DirPath(opts.S3DestKey)
+
+	c.Log.Infof("IN: %s, OUT: %s, SIZES: %d", opts.S3SrcKey, opts.S3DestKey, opts.Sizes)
+
+	// track what is going on
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	// ------  LIST OBJECTS -----------------------------------
+
+	// list all SOURCE files recursively
+	// for the directory to process from ("originals")
+	srcObjects, _, err := c.Storage.List(ctx, c.Bucket, opts.S3SrcKey, false)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to get src s3 object list")
+	}
+
+	c.Log.Infof("SOURCE OBJECTS: %d", len(srcObjects))
+
+	// ------  CLEANUP OUTPUT DIR AND GET LIST TO REBUILD -----------------------------------
+
+	objectsToProcess := &[]*util.S3Object{}
+
+	// if rebuilding all files, then remove the entire destination directory
+	if opts.RebuildAll {
+		// when resuming, the outputs were deleted by the earlier run, and some are already rebuilt
+		if !journal.HasPlan() {
+			// processed files are rebuilt from the originals, so they skip the trash
+			deleteOpts := DeleteOptions{
+				S3Key:     opts.S3DestKey,
+				IsDir:     true,
+				Permanent: true,
+			}
+			// check the error
+			_, err = c.Delete(ctx, deleteOpts)
+			if err != nil {
+				return nil, fmt.Errorf("failed running delete with opts: %s: %s", util.QueryString(deleteOpts), err)
+			}
+
+			if !c.DryRun {
+				c.Log.Infof("DELETED: %s", opts.S3DestKey)
+			}
+		}
+
+		// set all objects in the path to be processed
+		objectsToProcess = &srcObjects
+	} else {
+		// list all DEST files recursively
+		// for the directory to process to ("processed")
+		destObjects, _, err := c.Storage.List(ctx, c.Bucket, opts.S3DestKey, false)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to get s3 dest object list")
+		}
+
+		// filter objects to process
+		// only process new files
+		// based on the processed output, what do we expect to see in the originals dir?
+		// and when was the oldest output for each of those processed?
+		var expects []string
+		expectsModified := map[string]time.Time{}
+		for _, dobj := range destObjects {
+
+			// strip the base dest key
+			destPath := strings.Replace(dobj.Key, util.EnsureS3DirPath(opts.S3DestKey), "", 1)
+
+			for _, size := range opts.Sizes {
+
+				// get the size string
+				sizeStr := strconv.Itoa(size)
+
+				// if starts with the specific size prefix
+				if strings.Index(destPath, sizeStr) == 0 {
+					// strip the size, too
+					destPathSize := strings.Replace(destPath, util.EnsureS3DirPath(sizeStr), "", 1)
+
+					// if expects does not already contain, append
+					contained := false
+					for _, e := range expects {
+						if strings.EqualFold(e, destPathSize) {
+							contained = true
+						}
+					}
+
+					if !contained {
+						expects = append(expects, destPathSize)
+					}
+
+					// track the oldest output
+					modKey := strings.ToLower(destPathSize)
+					if modified, ok := expectsModified[modKey]; !ok || dobj.LastModified.Before(modified) {
+						expectsModified[modKey] = dobj.LastModified
+					}
+				}
+
+			}
+		}
+
+		c.Log.Infof("EXPECTING %d IN %s", len(expects), opts.S3SrcKey)
+
+		// look through every original and find what is there that is not in the other place
+		for _, sobj := range srcObjects {
+
+			// string the base original path from the src
+			path := strings.Replace(sobj.Key, util.EnsureS3DirPath(opts.S3SrcKey), "", 1)
+
+			// look through the expects and find a match
+			found := false
+			for _, expect := range expects {
+				if strings.EqualFold(expect, path) {
+					// c.Log.Infof("CHECK: '%s'", expect)
+					found = true
+				}
+			}
+
+			// the original changed after it was processed
+			changed := false
+			if found && sobj.LastModified.After(expectsModified[strings.ToLower(path)]) {
+				changed = true
+			}
+
+			// process if not found, or changed
+			if !found || changed {
+
+				// is this an image?
+				// good compromise for image format determination
+				isImage := false
+				for _, format := range util.SupportedCaptureFormats() {
+					if strings.EqualFold(format, strings.ReplaceAll(filepath.Ext(path), ".", "")) {
+						isImage = true
+						break
+					}
+				}
+
+				// if image, add it to list for processing
+				if isImage {
+					if changed {
+						c.Log.Infof("CHANGED: '%s'", path)
+					} else {
+						c.Log.Infof("NEW: '%s'", path)
+					}
+					*objectsToProcess = append(*objectsToProcess, sobj)
+				}
+			}
+		}
+	}
+
+	c.Log.Infof("TO PROCESS: %d", len(*objectsToProcess))
+
+	// ------  FILTER FOR IMAGES -----------------------------------
+
+	// waitGroupFuncs
+	imagesToProcess := []*util.S3Object{}
+
+	// filter to images only
+	for _, obj := range *objectsToProcess {
+
+		// if partial path matches
+		// include it as a match
+		// to keep "c" from matching from "candler"
+		isMatch := false
+		partials := strings.Split(obj.Key, util.S3Delimiter)
+		for idx := range partials {
+			slice := partials[0:idx]
+			dirToMatch := util.EnsureS3DirPath(strings.Join(slice, util.S3Delimiter))
+			// c.Log.Infof("%s ?? %s", opts.S3SrcKey, util.EnsureS3DirPath(strings.Join(slice, util.S3Delimiter)))
+			if strings.EqualFold(opts.S3SrcKey, dirToMatch) {
+				isMatch = true
+			}
+		}
+
+		// is this an image?
+		// good compromise for image format determination
+		isImage := false
+		if isMatch {
+			for _, format := range util.SupportedCaptureFormats() {
+				if strings.EqualFold(format, obj.Extension) {
+					isImage = true
+					break
+				}
+			}
+		}
+
+		// if match, put in image slice
+		// else file slice
+		if isImage && isMatch {
+			imagesToProcess = append(imagesToProcess, obj)
+		}
+	}
+
+	// leave out what was done before, when resuming
+	imagesToProcess, err = c.plan(journal, imagesToProcess)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to record objects to process")
+	}
+
+	// ------  DRY RUN -----------------------------------
+
+	if c.DryRun {
+		for _, img := range imagesToProcess {
+			for _, size := range opts.Sizes {
+				sizeOutKey := strings.ReplaceAll(img.Key, util.EnsureS3DirPath(opts.S3SrcKey), util.EnsureS3DirPath(strconv.Itoa(size)))
+				c.Log.Infof("DRY RUN: (process) %s => %s", img.Key, util.JoinS3Path(opts.S3DestKey, sizeOutKey))
+			}
+		}
+		c.Log.Infof("DRY RUN: %d objects", len(imagesToProcess))
+		return newProcessResult(report), report.Finish()
+	}
+
+	// ------ FIRE WAITGROUP -----------------------------------
+
+	// open a new wait group with a maximum number of concurrent workers
+	wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 5))
+
+	// loop through all objects and spawn goroutines to wait for
+	for _, img := range imagesToProcess {
+		if report.Cancelled(ctx, img.Key) {
+			continue
+		}
+
+		// block adding until the next worker has finished
+		wg.BlockAdd()
+
+		// on a separate goroutine, do something asyncronous
+		// download, process, upload
+		go func(origFullKey string) {
+			funcTag := "ProcessImageWorker"
+			defer wg.Done()
+
+			c.Log.Infof("WORK: (%d) %s", opts.Sizes, origFullKey)
+
+			// ------  DOWNLOAD ORIGINAL -----------------------------------
+			inBuf, err := c.Storage.Get(ctx, c.Bucket, origFullKey)
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to download bucket object: %s", origFullKey))
+				c.Log.Warnf(err.Error())
+				report.Fail(origFullKey, err)
+				return
+			}
+
+			// convert bytes to image.Image
+			img, _, err := image.Decode(bytes.NewReader(inBuf))
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to decode bytes: %s", origFullKey))
+				c.Log.Warnf(err.Error())
+				report.Fail(origFullKey, err)
+				return
+			}
+
+			// ------  PROCESS & UPLOAD OUTPUTS -----------------------------------
+
+			// build the output objects
+			var outputImages []*ProcessedImage
+			for _, size := range opts.Sizes {
+
+				// key / directory for sizes
+				// replace the inDirKey with the size, then tack on the outDirKey
+				sizeOutKey := strings.ReplaceAll(origFullKey, util.EnsureS3DirPath(opts.S3SrcKey), util.EnsureS3DirPath(strconv.Itoa(size)))
+				fullOutKey := util.JoinS3Path(opts.S3DestKey, sizeOutKey)
+
+				// append to list of output images
+				outputImages = append(outputImages, &ProcessedImage{
+					Size: size,
+					Key:  fullOutKey,
+				})
+			}
+
+			// process and upload
+			var outputBytes int64
+			var outputKeys []string
+			for _, oi := range outputImages {
+
+				// resize
+				imgResized := imaging.Resize(img, oi.Size, 0, imaging.Lanczos)
+
+				// convert back to bytes
+				oi.Buffer = new(bytes.Buffer)
+				err = jpeg.Encode(oi.Buffer, imgResized, nil)
+				if err != nil {
+					err = util.WrapError(err, funcTag, fmt.Sprintf("failed to encode resized image: %s", oi.Key))
+					c.Log.Warnf(err.Error())
+					report.Fail(origFullKey, err)
+					return
+				}
+				oi.Bytes = oi.Buffer.Bytes()
+
+				// send to AWS
+				err = c.Storage.Put(ctx, c.Bucket, acl, oi.Key, bytes.NewReader(oi.Bytes))
+				if err != nil {
+					err = util.WrapError(err, funcTag, fmt.Sprintf("failed to send bytes to s3: %s", oi.Key))
+					c.Log.Warnf(err.Error())
+					report.Fail(origFullKey, err)
+					return
+				}
+				outputBytes += int64(len(oi.Bytes))
+				outputKeys = append(outputKeys, oi.Key)
+
+				c.Log.Infof("RESIZED: %s", oi.Key)
+			}
+
+			// track
+			c.done(journal, origFullKey)
+			report.Succeed(origFullKey, outputBytes)
+			report.AddResult(&ProcessedObject{
+				Key:     origFullKey,
+				Outputs: outputKeys,
+			})
+
+			c.Log.Infof("DONE: (%d) %s", opts.Sizes, origFullKey)
+
+			// we need these injected here
+		}(img.Key)
+	}
+
+	// wait on everything to complete
+	wg.Wait()
+
+	err = report.Finish()
+	c.Log.Infof("PROCESSED: %d", len(report.Succeeded))
+
+	return newProcessResult(report), err
+}
+
+// ProcessOptions are the options for Process
+type ProcessOptions struct {
+	S3SrcKey     string
+	S3DestKey    string
+	Sizes        []int
+	IsDestPublic bool
+	RebuildAll   bool
+	RebuildNew   bool
+	// Resume is a journal to continue processing from
+	Resume string `json:"-"`
+	// Workers is how many objects are processed at once, over the client Concurrency
+	Workers int `json:"-"`
+}
+
+// validate checks the options of a process
+func (opts *ProcessOptions) validate() error {
+	funcTag := "process"
+
+	// validate the in dir
+	if len(opts.S3SrcKey) == 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, "must provide a value for `--s3-src-key`")
+	}
+
+	// validate the out dir
+	if len(opts.S3DestKey) == 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, "must provide a value for `--s3-dest-key`")
+	}
+
+	// validate that in and out are not the same
+	if strings.EqualFold(util.EnsureS3DirPath(opts.S3SrcKey), util.EnsureS3DirPath(opts.S3DestKey)) {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("input and output keys cannot be the same: '%s' vs '%s'", opts.S3SrcKey, opts.S3DestKey))
+	}
+
+	return nil
+}
+
+// ProcessedObject is a processed original, and the keys of its outputs
+type ProcessedObject struct {
+	Key     string   `json:"key"`
+	Outputs []string `json:"outputs"`
+}
+
+// ProcessResult is what Process did
+type ProcessResult struct {
+	Report    *util.OperationReport
+	Processed []*ProcessedObject
+}
+
+// newProcessResult gets the typed result from the report
+func newProcessResult(report *util.OperationReport) *ProcessResult {
+	result := &ProcessResult{Report: report}
+	for _, r := range report.Results {
+		result.Processed = append(result.Processed, r.(*ProcessedObject))
+	}
+	return result
+}
+
+// ProcessedImage ties together all we need
+// in order to upload to a bucket
+type ProcessedImage struct {
+	Bytes  []byte
+	Buffer *bytes.Buffer
+	Key    string
+	Size   int
+}
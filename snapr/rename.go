@@ -0,0 +1,266 @@
+package snapr
+
+import (
+	"context"
+	"fmt"
+	"snapr/util"
+	"strings"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Rename renames an object, or all the objects under a directory key
+// or copies them, when asked to or when the destination bucket is different
+func (c *Client) Rename(ctx context.Context, opts RenameOptions) (result *RenameResult, err error) {
+	funcTag := "rename"
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// keep track of directory renames, or pick up where one stopped
+	journal, err := c.startJournal(funcTag, opts.Resume, opts.SrcIsDir, &opts, opts.validate)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to set up journal")
+	}
+	defer func() { c.endJournal(journal, err) }()
+
+	// default dest bucket to current s3 bucket if not already done
+	if len(opts.S3DestBucket) == 0 {
+		opts.S3DestBucket = c.Bucket
+	}
+
+	// set the object acl to "private"
+	destAcl := "private"
+	// unless set to public
+	if opts.IsDestPublic {
+		destAcl = "public-read"
+	}
+	c.Log.Infof("With DESTINATION Access ACL: %s", destAcl)
+
+	// the content type, headers and metadata are kept, unless set here
+	copyOpts := util.CopyOptions{
+		ACL:                destAcl,
+		Metadata:           opts.Metadata,
+		ContentType:        opts.ContentType,
+		ContentDisposition: opts.ContentDisposition,
+		CacheControl:       opts.CacheControl,
+	}
+
+	// track operated object keys
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	if !opts.SrcIsDir {
+
+		// files
+		srcObj := util.S3Object{Key: opts.S3SourceKey}
+		destObj := util.S3Object{Key: opts.S3DestKey}
+
+		// check if the objct exists
+		head, err := c.Storage.Head(ctx, c.Bucket, srcObj.Key)
+		if err != nil {
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("failed to confirm object existence, or object does not exist in bucket: '%s/%s'", c.Bucket, srcObj.Key))
+		}
+		// c.Log.Infof("Object exists: %s", file.Key)
+
+		if c.DryRun {
+			c.Log.Infof("DRY RUN: (rename) %s => %s", srcObj.Key, destObj.Key)
+			return newRenameResult(report), report.Finish()
+		}
+
+		// rename the object
+		err = c.Storage.Copy(ctx, c.Bucket, srcObj.Key, opts.S3DestBucket, destObj.Key, copyOpts)
+		if err != nil {
+			err = util.WrapError(err, funcTag, fmt.Sprintf("failed to rename object: %s", srcObj.Key))
+			report.Fail(srcObj.Key, err)
+			return newRenameResult(report), err
+		}
+
+		report.Succeed(srcObj.Key, head.Size)
+		report.AddResult(&RenamedObject{
+			SrcKey:     srcObj.Key,
+			DestKey:    destObj.Key,
+			DestBucket: opts.S3DestBucket,
+			Size:       head.Size,
+		})
+		c.Log.Infof("Renamed: %s to %s", srcObj.Key, destObj.Key)
+	} else {
+
+		// make sure that it is directory, we add an extra slash
+		opts.S3SourceKey = util.EnsureS3DirPath(opts.S3SourceKey)
+		opts.S3DestKey = util.EnsureS3DirPath(opts.S3DestKey)
+
+		c.Log.Infof("SRC: %s, DEST: %s", opts.S3SourceKey, opts.S3DestKey)
+
+		// get all the objects in the bucket
+		objects, _, err := c.Storage.List(ctx, c.Bucket, opts.S3SourceKey, false)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to get a list bucket objects for key: %s", opts.S3SourceKey))
+		}
+
+		// leave out what was done before, when resuming
+		objects, err = c.plan(journal, objects)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "failed to record objects to rename")
+		}
+
+		if c.DryRun {
+			for _, srcObj := range objects {
+				c.Log.Infof("DRY RUN: (rename) %s => %s", srcObj.Key, strings.ReplaceAll(srcObj.Key, opts.S3SourceKey, opts.S3DestKey))
+			}
+			c.Log.Infof("DRY RUN: %d objects", len(objects))
+			return newRenameResult(report), report.Finish()
+		}
+
+		// ask first, for a lot of objects
+		err = c.confirm("rename", opts.S3SourceKey, objects)
+		if err != nil {
+			return nil, err
+		}
+
+		// open a new wait group with a maximum number of concurrent workers
+		wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 100))
+
+		// for every object, we want a worker to change the key
+		for _, srcObj := range objects {
+			if report.Cancelled(ctx, srcObj.Key) {
+				continue
+			}
+
+			// block adding until the next worker has finished
+			wg.BlockAdd()
+
+			destObj := &util.S3Object{Key: strings.ReplaceAll(srcObj.Key, opts.S3SourceKey, opts.S3DestKey)}
+			c.Log.Infof("KEY: %s ==> %s", srcObj.Key, destObj.Key)
+
+			// on a separate goroutine, do something asyncronous
+			go func(srcObj *util.S3Object) {
+				funcTag := "RenameObjectWorker"
+				defer wg.Done()
+
+				// same or different buckets?
+				differentBuckets := !strings.EqualFold(c.Bucket, opts.S3DestBucket)
+
+				// to copy or rename (copy and delete) ?
+				var err error
+				if opts.IsCopyOperation || differentBuckets {
+					// copy the object
+					err = c.Storage.Copy(ctx, c.Bucket, srcObj.Key, opts.S3DestBucket, destObj.Key, copyOpts)
+				} else {
+					// rename the object
+					err = util.RenameObject(ctx, c.Storage, c.Bucket, srcObj.Key, opts.S3DestBucket, destObj.Key, copyOpts)
+				}
+				if err != nil {
+					err = util.WrapError(err, funcTag, fmt.Sprintf("failed to rename object: %s", srcObj.Key))
+					c.Log.Warnf(err.Error())
+					report.Fail(srcObj.Key, err)
+					return
+				}
+
+				// add to tracker
+				c.done(journal, srcObj.Key)
+				report.Succeed(srcObj.Key, srcObj.Size)
+				report.AddResult(&RenamedObject{
+					SrcKey:     srcObj.Key,
+					DestKey:    destObj.Key,
+					DestBucket: opts.S3DestBucket,
+					Size:       srcObj.Size,
+				})
+
+				// we need these injected here
+			}(srcObj)
+		}
+
+		// wait on everything to complete
+		wg.Wait()
+
+		c.Log.Infof("Renamed all objects from %s to %s", opts.S3SourceKey, opts.S3DestKey)
+	}
+
+	err = report.Finish()
+	c.Log.Infof("%d objects renamed", len(report.Succeeded))
+
+	// record what moved, so it can be undone
+	// a single object is only ever copied, and objects going to another bucket are too
+	result = newRenameResult(report)
+	operation := util.HistoryRename
+	if opts.IsCopyOperation {
+		operation = util.HistoryCopy
+	}
+	isCopy := opts.IsCopyOperation || !opts.SrcIsDir || !strings.EqualFold(c.Bucket, opts.S3DestBucket)
+	var moves []*util.HistoryMove
+	for _, renamed := range result.Renamed {
+		moves = append(moves, &util.HistoryMove{
+			SrcBucket:  c.Bucket,
+			SrcKey:     renamed.SrcKey,
+			DestBucket: renamed.DestBucket,
+			DestKey:    renamed.DestKey,
+			Size:       renamed.Size,
+			Copy:       isCopy,
+		})
+	}
+	result.HistoryID = c.record(operation, opts.S3SourceKey, moves)
+
+	return result, err
+}
+
+// RenameOptions are the options for Rename
+type RenameOptions struct {
+	S3SourceKey     string
+	S3DestKey       string
+	S3DestBucket    string
+	SrcIsDir        bool
+	IsCopyOperation bool
+	IsDestPublic    bool
+	// Resume is a journal to continue a directory rename from
+	Resume string `json:"-"`
+	// Workers is how many objects are renamed at once, over the client Concurrency
+	Workers int `json:"-"`
+	// headers and metadata to change on the copies, the rest is kept from the source
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+	Metadata           map[string]string
+}
+
+// validate checks the options of a rename
+func (opts *RenameOptions) validate() error {
+	funcTag := "rename"
+
+	// validate required arg
+	if len(opts.S3SourceKey) == 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, "option `--s3-src-key` is required")
+	}
+
+	// validate required arg
+	if len(opts.S3DestKey) == 0 {
+		return util.WrapError(fmt.Errorf("validation error"), funcTag, "option `--s3-dest-key` is required")
+	}
+
+	return nil
+}
+
+// RenamedObject is a renamed (or copied) object
+type RenamedObject struct {
+	SrcKey     string `json:"src_key"`
+	DestKey    string `json:"dest_key"`
+	DestBucket string `json:"dest_bucket"`
+	Size       int64  `json:"size"`
+}
+
+// RenameResult is what Rename did
+type RenameResult struct {
+	Report  *util.OperationReport
+	Renamed []*RenamedObject
+	// HistoryID is the history entry to undo this with, if one was recorded
+	HistoryID string
+}
+
+// newRenameResult gets the typed result from the report
+func newRenameResult(report *util.OperationReport) *RenameResult {
+	result := &RenameResult{Report: report}
+	for _, r := range report.Results {
+		result.Renamed = append(result.Renamed, r.(*RenamedObject))
+	}
+	return result
+}
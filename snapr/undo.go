@@ -0,0 +1,190 @@
+package snapr
+
+import (
+	"context"
+	"fmt"
+	"snapr/util"
+	"sync"
+	"time"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Undo reverses a rename, copy or delete from the history
+// moved objects go back to their source keys, and copies are deleted
+// moves that were undone are recorded, so an undo that stopped can be run again for the rest
+func (c *Client) Undo(ctx context.Context, opts UndoOptions) (*UndoResult, error) {
+	funcTag := "undo"
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// validate required arg
+	if len(opts.ID) == 0 {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "an operation id is required")
+	}
+
+	if c.History == nil {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "no history is kept")
+	}
+
+	entry, err := c.History.Load(ctx, opts.ID)
+	if err != nil {
+		return nil, util.WrapError(err, funcTag, "failed to load operation")
+	}
+
+	// the same keys in another bucket are not the same objects
+	if entry.Bucket != c.Bucket {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("operation is for bucket '%s', not '%s': %s", entry.Bucket, c.Bucket, entry.ID))
+	}
+	if entry.UndoneAt != nil {
+		return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("operation was already undone at %s: %s", entry.UndoneAt.Local().Format("2006-01-02 15:04:05"), entry.ID))
+	}
+
+	// only what was not undone before
+	var moves []*util.HistoryMove
+	var objects []*util.S3Object
+	for _, move := range entry.Moves {
+		if move.Undone {
+			continue
+		}
+		moves = append(moves, move)
+		objects = append(objects, &util.S3Object{Key: move.DestKey, Size: move.Size})
+	}
+
+	// track operated object keys
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	if c.DryRun {
+		for _, move := range moves {
+			if move.Copy {
+				c.Log.Infof("DRY RUN: (delete) %s", move.DestKey)
+				continue
+			}
+			c.Log.Infof("DRY RUN: (undo) %s => %s", move.DestKey, move.SrcKey)
+		}
+		c.Log.Infof("DRY RUN: %d objects", len(moves))
+		return newUndoResult(report), report.Finish()
+	}
+
+	// ask first, for a lot of objects
+	err = c.confirm("undo", entry.ID, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	// moves are marked undone from many workers
+	var mutex sync.Mutex
+
+	// open a new wait group with a maximum number of concurrent workers
+	wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 100))
+
+	for _, move := range moves {
+		if report.Cancelled(ctx, move.DestKey) {
+			continue
+		}
+
+		// block adding until the next worker has finished
+		wg.BlockAdd()
+
+		go func(move *util.HistoryMove) {
+			funcTag := "UndoMoveWorker"
+			defer wg.Done()
+
+			undone := &UndoneObject{Key: move.DestKey, Bucket: move.DestBucket}
+			var err error
+			if move.Copy {
+				// the source is still there, so the copy goes
+				err = c.Storage.Delete(ctx, move.DestBucket, move.DestKey)
+			} else {
+				// do not write over anything that took the source key since
+				if !opts.Overwrite {
+					if _, headErr := c.Storage.Head(ctx, move.SrcBucket, move.SrcKey); headErr == nil {
+						err = fmt.Errorf("an object already exists at '%s', use `--overwrite` to replace it", move.SrcKey)
+					}
+				}
+				if err == nil {
+					err = util.RestoreObject(ctx, c.Storage, move.DestBucket, move.DestKey, move.SrcBucket, move.SrcKey)
+				}
+				undone.RestoredKey = move.SrcKey
+				undone.RestoredBucket = move.SrcBucket
+			}
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to undo: %s", move.DestKey))
+				c.Log.Warnf(err.Error())
+				report.Fail(move.DestKey, err)
+				return
+			}
+
+			mutex.Lock()
+			move.Undone = true
+			mutex.Unlock()
+
+			report.Succeed(move.DestKey, move.Size)
+			report.AddResult(undone)
+			if move.Copy {
+				c.Log.Infof("Deleted copy: %s", move.DestKey)
+			} else {
+				c.Log.Infof("Moved back: %s => %s", move.DestKey, move.SrcKey)
+			}
+		}(move)
+	}
+
+	// wait on everything to complete
+	wg.Wait()
+
+	// the whole operation is undone once every move is
+	finished := true
+	for _, move := range entry.Moves {
+		finished = finished && move.Undone
+	}
+	if finished {
+		now := time.Now()
+		entry.UndoneAt = &now
+	}
+
+	// save what was undone, even once stopped, so it is not done twice
+	saveErr := c.History.Save(context.Background(), entry)
+	if saveErr != nil {
+		c.Log.Warnf(util.WrapError(saveErr, funcTag, "failed to record undo").Error())
+	}
+
+	err = report.Finish()
+	c.Log.Infof("%d objects undone from %s", len(report.Succeeded), entry.ID)
+
+	return newUndoResult(report), err
+}
+
+// UndoOptions are the options for Undo
+type UndoOptions struct {
+	// ID is the history entry to undo
+	ID string
+	// Overwrite replaces objects that took a source key since
+	Overwrite bool
+	// Workers is how many objects are undone at once, over the client Concurrency
+	Workers int
+}
+
+// UndoneObject is an object that was moved back, or a copy that was deleted
+type UndoneObject struct {
+	Key            string `json:"key"`
+	Bucket         string `json:"bucket"`
+	RestoredKey    string `json:"restored_key,omitempty"`
+	RestoredBucket string `json:"restored_bucket,omitempty"`
+}
+
+// UndoResult is what Undo did
+type UndoResult struct {
+	Report *util.OperationReport
+	Undone []*UndoneObject
+}
+
+// newUndoResult gets the typed result from the report
+func newUndoResult(report *util.OperationReport) *UndoResult {
+	result := &UndoResult{Report: report}
+	for _, r := range report.Results {
+		result.Undone = append(result.Undone, r.(*UndoneObject))
+	}
+	return result
+}
@@ -0,0 +1,282 @@
+package snapr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"snapr/util"
+	"strings"
+
+	"github.com/pieterclaerhout/go-waitgroup"
+)
+
+// Upload uploads a file, or the files in a directory
+func (c *Client) Upload(ctx context.Context, opts UploadOptions) (*UploadResult, error) {
+	funcTag := "upload"
+	var err error
+
+	// the storage backend logs to the client too
+	ctx = util.WithLogger(ctx, c.Log)
+
+	// check limit, is it a crazy high number? if so kick it back
+	if opts.UploadLimit > 100 {
+		return nil, util.WrapError(fmt.Errorf("Validation Error"), funcTag, "choose an upload limit smaller than 100")
+	}
+
+	// default the limit to 1 if 0
+	// this situation can happen in testing, where the cobra args arent eval-ed
+	if opts.UploadLimit < 1 {
+		opts.UploadLimit = 1
+	}
+
+	// make sure that it is directory, we add an extra slash
+	opts.S3Dir = util.EnsureS3DirPath(opts.S3Dir)
+
+	// handle the dir and file inputs
+	// and get a list of files based on the inputs
+	var files []*util.WalkedFile
+	if len(opts.InFile) > 0 {
+		// if the file override is set,
+		// ignore the walk and upload limit
+
+		// if dir is also set, join
+		if len(opts.InDir) > 0 {
+			opts.InFile = filepath.Join(opts.InDir, opts.InFile)
+		}
+
+		// get the abs file path
+		absPath, err := filepath.Abs(opts.InFile)
+		if err != nil {
+			c.Log.Warnf("cannot convert path to absolute file path: %s", opts.InFile)
+		}
+
+		// set these explicitly
+		opts.InDir = filepath.Dir(absPath)
+		opts.InFile = filepath.Base(absPath)
+
+		// join the override file path with the dir
+		fullPath := filepath.Join(opts.InDir, opts.InFile)
+
+		// stat the path
+		fileInfo, err := os.Stat(fullPath)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "cannot stat path")
+		}
+
+		// ensure is a file
+		if fileInfo.IsDir() {
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "`--file` cannot be a directory")
+		}
+
+		// append the walked file struct
+		files = append(files, &util.WalkedFile{
+			Path:     fullPath,
+			FileInfo: fileInfo,
+		})
+	} else {
+		// file override is empty
+
+		// default the in dir if empty
+		if len(opts.InDir) == 0 {
+			// default to the directory where the binary exists (pwd)
+			opts.InDir, err = os.Getwd()
+			if err != nil {
+				return nil, util.WrapError(err, funcTag, "cannot get pwd for `--dir")
+			}
+		}
+
+		// get the abs dir path
+		opts.InDir, err = filepath.Abs(opts.InDir)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("cannot convert path for `--dir`: %s", opts.InDir))
+		}
+		c.Log.Infof("ABS DIR: %s", opts.InDir)
+
+		// stat the path
+		fileInfo, err := os.Stat(opts.InDir)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, "cannot stat path")
+		}
+
+		// ensure is a dir
+		if !fileInfo.IsDir() {
+			return nil, util.WrapError(fmt.Errorf("validation error"), funcTag, "dir provided is not a directory")
+		}
+
+		// get the slice of walkedFiles
+		// based on the indir, walk all files
+		files, err = util.WalkFiles(opts.InDir)
+		if err != nil {
+			return nil, util.WrapError(err, funcTag, fmt.Sprintf("failed to walk dir for files to upload: %s", opts.InDir))
+		}
+	}
+
+	c.Log.Infof("Got %d file(s)", len(files))
+
+	// TODO: order the files with the oldest first and newest last
+
+	// filter out files without specific filename format
+	var filteredFiles = files
+
+	// if the option is set, it will filter out files by extension
+	if len(opts.Formats) > 0 {
+		c.Log.Infof("Filtering formats: %s", strings.Join(opts.Formats, ","))
+
+		// reset and append
+		filteredFiles = nil
+		for _, file := range files {
+
+			// get the file extension, and replace the dot (weirdness of this lib)
+			fileExt := strings.ReplaceAll(filepath.Ext(file.Path), ".", "")
+
+			// filter formats
+			for _, format := range opts.Formats {
+				// if the format matches
+				if strings.EqualFold(fileExt, format) {
+					// append the file to the slice
+					filteredFiles = append(filteredFiles, file)
+				}
+			}
+		}
+		c.Log.Infof("Got %d files after filtering", len(filteredFiles))
+	}
+
+	// if no files after filtering, error
+	if len(filteredFiles) == 0 {
+		return nil, util.WrapError(fmt.Errorf("Validation Error"), funcTag, "no files with specified format exist at target")
+	}
+
+	// attempt to chop off a slice of these equal to the limit input
+	uploadLimit := len(filteredFiles)
+	// if upload limit is greater than 1, take the minimum of the length of files and the limit
+	if opts.UploadLimit > 1 {
+		uploadLimit = util.MinInt(opts.UploadLimit, len(filteredFiles))
+	}
+	c.Log.Infof("Upload Limit: %d", uploadLimit)
+
+	// truncate filtered files
+	filteredFiles = filteredFiles[0:uploadLimit]
+	c.Log.Infof("Uploading %d file(s)", len(filteredFiles))
+
+	// get the base s3 key, if any
+	baseS3Key := util.EnsureS3DirPath(opts.S3Dir)
+	c.Log.Infof("S3 Base Key: %s", baseS3Key)
+
+	// TODO: add backup capability (later) - Get bucket contents by key recursively and check if same key
+
+	// get the keys and determine if they exist
+	for _, file := range filteredFiles {
+		// get the base s3 dir
+		// first, get the key from the end of the filename
+		file.S3Key = strings.ReplaceAll(file.Path, opts.InDir+"/", "")
+		if len(opts.S3Dir) > 0 {
+			file.S3Key = util.JoinS3Path(opts.S3Dir, file.S3Key)
+		}
+	}
+
+	// set the object acl to "private"
+	acl := "private"
+	// unless set to public
+	if opts.Public {
+		acl = "public-read"
+	}
+	c.Log.Infof("With Access ACL: %s", acl)
+
+	// ------  UPLOADING -----------------------------------
+
+	// open a new wait group with a maximum number of concurrent workers
+	wg := waitgroup.NewWaitGroup(c.workers(opts.Workers, 1))
+
+	// track what is going on
+	report := util.NewOperationReport(funcTag)
+	ctx = util.WithOperationReport(ctx, report)
+
+	// loop through all objects and spawn goroutines to wait for
+	for _, waffle := range filteredFiles {
+		if report.Cancelled(ctx, waffle.S3Key) {
+			continue
+		}
+
+		// block adding until the next worker has finished
+		wg.BlockAdd()
+
+		go func(waffle *util.WalkedFile) {
+			funcTag := "HandleUploadFileWithCleanupWorker"
+			defer wg.Done()
+
+			// send to AWS
+			err := util.WriteFile(ctx, c.Storage, c.Bucket, acl, waffle.S3Key, waffle)
+			if err != nil {
+				err = util.WrapError(err, funcTag, fmt.Sprintf("failed to send file to s3: %s", waffle.Path))
+				c.Log.Warnf(err.Error())
+				report.Fail(waffle.S3Key, err)
+				return
+			}
+
+			c.Log.Infof("Uploaded key: %s", waffle.S3Key)
+
+			// after success, cleanup the files
+			if opts.CleanupAfterSuccess {
+
+				// remove the file from the os if desired
+				err = os.Remove(waffle.Path)
+				if err != nil {
+					err = util.WrapError(err, funcTag, "failed to remove local file from disk after upload")
+					c.Log.Warnf(err.Error())
+					report.Fail(waffle.S3Key, err)
+					return
+				}
+
+				c.Log.Infof("Cleaned up file: %s", waffle.Path)
+			}
+
+			report.Succeed(waffle.S3Key, waffle.FileInfo.Size())
+			report.AddResult(&UploadedFile{
+				Key:   waffle.S3Key,
+				Path:  waffle.Path,
+				Bytes: waffle.FileInfo.Size(),
+			})
+
+		}(waffle)
+	}
+
+	// wait on everything to complete
+	wg.Wait()
+
+	err = report.Finish()
+	c.Log.Infof("UPLOADED: %d", len(report.Succeeded))
+
+	result := &UploadResult{Report: report}
+	for _, r := range report.Results {
+		result.Uploaded = append(result.Uploaded, r.(*UploadedFile))
+	}
+
+	return result, err
+}
+
+// UploadOptions are the options for Upload
+type UploadOptions struct {
+	InDir               string
+	InFile              string
+	CleanupAfterSuccess bool
+	Formats             []string
+	UploadLimit         int
+	S3Dir               string
+	Public              bool
+	// Workers is how many objects are uploaded at once, over the client Concurrency
+	Workers int
+}
+
+// UploadedFile is an uploaded file
+type UploadedFile struct {
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// UploadResult is what Upload did
+type UploadResult struct {
+	Report   *util.OperationReport
+	Uploaded []*UploadedFile
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"snapr/cli"
+	"snapr/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Test13BuildModes checks what the build mode allows
+// run it with `-tags prod` and `-tags restricted` too
+func Test13BuildModes(t *testing.T) {
+
+	name := util.EnvVarName("S3_BUCKET")
+	if old, ok := os.LookupEnv(name); ok {
+		defer os.Setenv(name, old)
+	} else {
+		defer os.Unsetenv(name)
+	}
+	os.Setenv(name, "env.bucket")
+	util.SetCompiledInEnv(map[string]string{name: "compiled.bucket", util.EnvVarName("S3_TOKEN"): "COMPILEDTOKEN"})
+	defer util.SetCompiledInEnv(nil)
+
+	// overrides
+	ropts := (&cli.RootCmdOptions{Bucket: "flag.bucket", AWSProfile: "work"}).SetupS3ConfigFromRootArgs()
+	if util.Build.AllowOverrides {
+		if ropts.Bucket != "flag.bucket" || ropts.S3Config.Profile != "work" {
+			t.Fatalf("expected the flag to replace the compiled-in bucket in a %s build: %s, %s", util.Build.Mode, ropts.Bucket, ropts.S3Config.Profile)
+		}
+		if bucket := util.EnvVarString("S3_BUCKET", ""); bucket != "env.bucket" {
+			t.Fatalf("expected the env to replace the compiled-in bucket in a %s build: %s", util.Build.Mode, bucket)
+		}
+	} else {
+		if ropts.Bucket != "compiled.bucket" || len(ropts.S3Config.Profile) > 0 || ropts.Token != "COMPILEDTOKEN" {
+			t.Fatalf("expected the compiled-in bucket and credentials in a %s build: %s, %s", util.Build.Mode, ropts.Bucket, ropts.S3Config.Profile)
+		}
+		if bucket := util.EnvVarString("S3_BUCKET", ""); bucket != "compiled.bucket" {
+			t.Fatalf("expected the env to not replace the compiled-in bucket in a %s build: %s", util.Build.Mode, bucket)
+		}
+	}
+
+	// query structs
+	query := util.QueryString(&s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key.jpg"), SSECustomerKey: aws.String("customerkey")})
+	if !strings.Contains(query, `"key.jpg"`) || strings.Contains(query, "customerkey") != util.Build.LogQueries {
+		t.Fatalf("expected the query to show the key, and only show everything in a dev build: %s", query)
+	}
+
+	// commands
+	if util.Build.CommandEnabled("serve") == (util.Build.Mode == util.BuildModeRestricted) {
+		t.Fatalf("expected serve to be disabled only in a restricted build")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"snapr/cli"
+	"snapr/snapr"
+	"snapr/util"
+)
+
+// Test6ClientFSBackend runs the library client against a local directory
+// and checks the typed results it returns
+func Test6ClientFSBackend(t *testing.T) {
+
+	// ensure the temp directory exists
+	_, testTempDir, err := ensureTestDir("test-6")
+	if err != nil {
+		t.Errorf("could not create test temp dir: %s", testTempDir)
+	}
+	// clean up on fail
+	defer cleanupTestDir(testTempDir)
+
+	// the "bucket" and the dirs we move files in and out of
+	bucketDir := filepath.Join(testTempDir, "bucket")
+	inDir := filepath.Join(testTempDir, "in")
+	outDir := filepath.Join(testTempDir, "out")
+	for _, dir := range []string{bucketDir, inDir, outDir} {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			t.Fatalf("could not create test dir: %s", dir)
+		}
+	}
+
+	_, err = copyFile("t_test.jpg", filepath.Join(inDir, "t_test.jpg"))
+	if err != nil {
+		t.Fatalf("could not copy test image file")
+	}
+
+	// the accessor for the local bucket, set up like the cli does
+	ropts := &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, JournalDir: filepath.Join(testTempDir, "journal"), HistoryDir: filepath.Join(testTempDir, "history")}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+
+	client, err := snapr.NewClient(ropts.S3Config, nil)
+	if err != nil {
+		t.Fatalf("could not get client: %s", err)
+	}
+	client.JournalDir = ropts.JournalDir
+	client.History = &util.History{Dir: filepath.Join(testTempDir, "history"), Prefix: ".snapr/history", Storage: client.Storage, Bucket: client.Bucket}
+	ctx := context.Background()
+
+	// UPLOAD
+	uploaded, err := client.Upload(ctx, snapr.UploadOptions{InDir: inDir, S3Dir: "originals", UploadLimit: 10})
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+	if len(uploaded.Uploaded) != 1 || uploaded.Uploaded[0].Key != "originals/t_test.jpg" {
+		t.Fatalf("unexpected upload result: %+v", uploaded.Uploaded)
+	}
+
+	// PROCESS
+	processed, err := client.Process(ctx, snapr.ProcessOptions{S3SrcKey: "originals", S3DestKey: "processed", Sizes: []int{50}})
+	if err != nil {
+		t.Fatalf("failed to process: %s", err)
+	}
+	if len(processed.Processed) != 1 || len(processed.Processed[0].Outputs) != 1 || processed.Processed[0].Outputs[0] != "processed/50/t_test.jpg" {
+		t.Fatalf("unexpected process result: %+v", processed.Processed)
+	}
+
+	// CANCELLED DOWNLOAD does nothing, and says why
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = client.Download(cancelledCtx, snapr.DownloadOptions{S3Key: "processed", IsDir: true, OutDir: outDir})
+	if err == nil {
+		t.Fatalf("expected a cancelled download to fail")
+	}
+	downloadedFiles, err := util.WalkFiles(outDir)
+	if err != nil || len(downloadedFiles) != 0 {
+		t.Fatalf("expected a cancelled download to download nothing: %d files, %v", len(downloadedFiles), err)
+	}
+
+	// RESUMED DOWNLOAD only downloads what the stopped run did not
+	journal, err := util.NewJournal(client.JournalDir, "download", client.Bucket, snapr.DownloadOptions{S3Key: "originals/", IsDir: true, OutDir: outDir, Workers: 2})
+	if err != nil {
+		t.Fatalf("could not start journal: %s", err)
+	}
+	if strings.Contains(string(journal.Options), "Workers") {
+		t.Fatalf("expected the journal to leave the workers to the resumed run: %s", journal.Options)
+	}
+	_, err = journal.Plan([]*util.S3Object{{Key: "originals/t_test.jpg"}, {Key: "processed/50/t_test.jpg"}})
+	if err == nil {
+		err = journal.Done("originals/t_test.jpg")
+	}
+	if err == nil {
+		err = journal.Close(false)
+	}
+	if err != nil {
+		t.Fatalf("could not write journal: %s", err)
+	}
+	downloaded, err := client.Download(ctx, snapr.DownloadOptions{Resume: journal.Path})
+	if err != nil {
+		t.Fatalf("failed to resume download: %s", err)
+	}
+	if len(downloaded.Downloaded) != 1 || downloaded.Downloaded[0].Key != "processed/50/t_test.jpg" {
+		t.Fatalf("unexpected resumed download result: %+v", downloaded.Downloaded)
+	}
+	if _, err := os.Stat(journal.Path); !os.IsNotExist(err) {
+		t.Fatalf("expected the finished journal to be removed: %s", journal.Path)
+	}
+
+	// an invalid operation leaves no journal to resume
+	journals, _ := ioutil.ReadDir(client.JournalDir)
+	if _, err := client.Rename(ctx, snapr.RenameOptions{S3SourceKey: "originals", SrcIsDir: true}); err == nil {
+		t.Fatalf("expected a rename without a destination to fail")
+	}
+	if after, _ := ioutil.ReadDir(client.JournalDir); len(after) != len(journals) {
+		t.Fatalf("expected no journal for an invalid rename: %d before, %d after", len(journals), len(after))
+	}
+
+	// DELETE
+	deleted, err := client.Delete(ctx, snapr.DeleteOptions{S3Key: "originals", IsDir: true})
+	if err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+	if len(deleted.Deleted) != 1 || !util.IsTrashKey(client.TrashDir, deleted.Deleted[0].TrashKey) {
+		t.Fatalf("expected the original to be in the trash: %+v", deleted.Deleted)
+	}
+
+	// UNDO the delete, from the copy of the history in the bucket
+	client.History.Dir = ""
+	history, err := client.History.List(ctx, 0)
+	if err != nil || len(history) != 1 || history[0].ID != deleted.HistoryID || history[0].Operation != util.HistoryDelete {
+		t.Fatalf("expected the delete in the history: %+v, %v", history, err)
+	}
+	if len(history[0].Moves) != 1 || history[0].Moves[0].Size == 0 {
+		t.Fatalf("expected the size of the deleted object in the history: %+v", history[0].Moves)
+	}
+	undone, err := client.Undo(ctx, snapr.UndoOptions{ID: deleted.HistoryID})
+	if err != nil {
+		t.Fatalf("failed to undo delete: %s", err)
+	}
+	if len(undone.Undone) != 1 || undone.Undone[0].RestoredKey != "originals/t_test.jpg" {
+		t.Fatalf("unexpected undo result: %+v", undone.Undone)
+	}
+	if undone.Report.Bytes != history[0].Moves[0].Size {
+		t.Fatalf("expected the undo to count the size of the object: %d bytes", undone.Report.Bytes)
+	}
+	if _, err := client.Storage.Head(ctx, client.Bucket, "originals/t_test.jpg"); err != nil {
+		t.Fatalf("expected the original to be back: %s", err)
+	}
+	if _, err := client.Undo(ctx, snapr.UndoOptions{ID: deleted.HistoryID}); err == nil {
+		t.Fatalf("expected a second undo to fail")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"snapr/cli"
+	"snapr/util"
+)
+
+// Test12ConfigCommands shows the config with redacted credentials,
+// and validates a local bucket with a probe key
+func Test12ConfigCommands(t *testing.T) {
+
+	// ensure the temp directory exists
+	_, testTempDir, err := ensureTestDir("test-12")
+	if err != nil {
+		t.Errorf("could not create test temp dir: %s", testTempDir)
+	}
+	// clean up on fail
+	defer cleanupTestDir(testTempDir)
+
+	bucketDir := filepath.Join(testTempDir, "bucket")
+	err = os.MkdirAll(bucketDir, 0700)
+	if err != nil {
+		t.Fatalf("could not create test dir: %s", bucketDir)
+	}
+
+	ropts := &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, Token: "AKIAEXAMPLETOKEN1234", Secret: "verysecretvalue5678", Output: cli.OutputJSON}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+
+	// the json goes to stdout
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not open pipe: %s", err)
+	}
+	os.Stdout = w
+	err = cli.ConfigShowCmdRunE(ropts, &cli.ConfigShowCmdOptions{})
+	w.Close()
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("failed to show config: %s", err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if strings.Contains(string(b), "verysecretvalue") || strings.Contains(string(b), "AKIAEXAMPLETOKEN") {
+		t.Fatalf("expected credentials to be redacted: %s", b)
+	}
+	var show cli.ConfigShow
+	err = json.Unmarshal(b, &show)
+	if err != nil {
+		t.Fatalf("failed to decode config: %s", err)
+	}
+	found := false
+	for _, setting := range show.Settings {
+		if setting.Env == "SNAPR_S3_SECRET" {
+			found = setting.Value == util.RedactSecret("verysecretvalue5678") && strings.HasSuffix(setting.Value, "5678")
+		}
+	}
+	if !found {
+		t.Fatalf("expected the redacted secret: %s", b)
+	}
+
+	// the probe key is put and deleted
+	ropts.Output = cli.OutputText
+	probeKey := "probe/key.txt"
+	err = cli.ConfigValidateCmdRunE(context.Background(), ropts, &cli.ConfigValidateCmdOptions{ProbeKey: probeKey})
+	if err != nil {
+		t.Fatalf("failed to validate config: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(bucketDir, probeKey)); !os.IsNotExist(err) {
+		t.Fatalf("expected the probe key to be deleted")
+	}
+
+	// no bucket fails
+	ropts = (&cli.RootCmdOptions{Backend: util.StorageBackendFS}).SetupS3ConfigFromRootArgs()
+	err = cli.ConfigValidateCmdRunE(context.Background(), ropts, &cli.ConfigValidateCmdOptions{ProbeKey: probeKey})
+	if err == nil {
+		t.Fatalf("expected validation to fail without a bucket")
+	}
+}
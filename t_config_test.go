@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"snapr/cli"
+	"snapr/util"
+)
+
+// Test11ConfigProfiles loads profiles from a config file
+// and checks that flags and env go before a profile, and a profile goes before the compiled-in .env
+func Test11ConfigProfiles(t *testing.T) {
+
+	// ensure the temp directory exists
+	_, testTempDir, err := ensureTestDir("test-11")
+	if err != nil {
+		t.Errorf("could not create test temp dir: %s", testTempDir)
+	}
+	// clean up on fail
+	defer cleanupTestDir(testTempDir)
+
+	configFile := filepath.Join(testTempDir, "config.yaml")
+	err = ioutil.WriteFile(configFile, []byte(`
+profile: photos
+profiles:
+  photos:
+    bucket: photos.bucket
+    region: us-west-2
+    endpoint: https://photos.local
+    credentials:
+      source: aws
+      aws_profile: photographer
+    prefixes:
+      upload: uploads
+    settings:
+      trash_dir: .bin
+  logs:
+    bucket: logs.bucket
+    credentials:
+      token: LOGSTOKEN
+      secret: logssecret
+`), 0600)
+	if err != nil {
+		t.Fatalf("could not write config file")
+	}
+
+	// a compiled-in .env, and a real env var
+	env := map[string]string{
+		"SNAPR_S3_REGION": "eu-west-1",
+		"SNAPR_PROFILE":   "",
+	}
+	for name, value := range env {
+		if old, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Setenv(name, value)
+	}
+	util.SetCompiledInEnv(map[string]string{
+		"SNAPR_S3_ENDPOINT": "https://compiled.local",
+		"SNAPR_S3_TOKEN":    "COMPILEDTOKEN",
+		"SNAPR_S3_SECRET":   "compiledsecret",
+	})
+	defer util.SetCompiledInEnv(nil)
+	defer util.SetProfileEnv(nil)
+
+	// the default profile of the file, under a flag
+	ropts := &cli.RootCmdOptions{ConfigFile: configFile, Bucket: "flag.bucket"}
+	err = ropts.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	s3Config := ropts.S3Config
+	if s3Config.Bucket != "flag.bucket" || s3Config.Region != "eu-west-1" || s3Config.Endpoint != "https://photos.local" ||
+		len(s3Config.Token) > 0 || s3Config.Profile != "photographer" || ropts.TrashDir != ".bin" {
+		t.Fatalf("expected flag > env > profile > compiled-in: %+v, trash dir %s", s3Config, ropts.TrashDir)
+	}
+	if prefix := util.EnvVarString("UPLOAD_S3_DIR", ""); prefix != "uploads" {
+		t.Fatalf("expected the upload prefix of the profile: %s", prefix)
+	}
+
+	// another profile, with its own keys
+	ropts = &cli.RootCmdOptions{ConfigFile: configFile, Profile: "logs"}
+	err = ropts.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config with profile: %s", err)
+	}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	s3Config = ropts.S3Config
+	if s3Config.Bucket != "logs.bucket" || s3Config.Token != "LOGSTOKEN" || s3Config.Endpoint != "https://compiled.local" || len(s3Config.Profile) > 0 {
+		t.Fatalf("expected the logs profile over the compiled-in .env: %+v", s3Config)
+	}
+
+	// a profile that is not in the file is an aws profile
+	ropts = &cli.RootCmdOptions{ConfigFile: configFile, Profile: "work"}
+	err = ropts.LoadConfig()
+	if err != nil {
+		t.Fatalf("failed to load config with aws profile: %s", err)
+	}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	if ropts.S3Config.Profile != "work" || ropts.S3Config.Token != "COMPILEDTOKEN" {
+		t.Fatalf("expected the aws profile and the compiled-in keys: %+v", ropts.S3Config)
+	}
+
+	// a missing file that was asked for is an error
+	ropts = &cli.RootCmdOptions{ConfigFile: filepath.Join(testTempDir, "missing.yaml")}
+	if err = ropts.LoadConfig(); err == nil {
+		t.Fatalf("expected an error for a missing config file")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"snapr/util"
+)
+
+// Test9CopyKeepsHeaders copies objects on a fake s3 endpoint
+// and checks that headers and metadata are kept, or changed when asked, and that large objects are copied in parts
+func Test9CopyKeepsHeaders(t *testing.T) {
+
+	// every request that changes something, by method and query
+	var mutex sync.Mutex
+	var requests []*http.Request
+	var objectSize = 7
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", objectSize))
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("X-Amz-Meta-Owner", "me")
+			w.Header().Set("X-Amz-Storage-Class", "STANDARD_IA")
+			if strings.HasPrefix(r.URL.Path, "/bucket/.trash/") {
+				w.Header().Set("X-Amz-Meta-Snapr-Original-Key", "a.jpg")
+				w.Header().Set("X-Amz-Meta-Snapr-Acl", "public-read")
+			}
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusOK)
+			return
+		case r.Method == http.MethodGet && hasQuery(query, "acl"):
+			w.Write([]byte(`<AccessControlPolicy><Owner><ID>owner</ID></Owner><AccessControlList>` +
+				`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>owner</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>` +
+				`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>` +
+				`</AccessControlList></AccessControlPolicy>`))
+		case r.Method == http.MethodGet && hasQuery(query, "tagging"):
+			w.Write([]byte(`<Tagging><TagSet><Tag><Key>album</Key><Value>2020</Value></Tag></TagSet></Tagging>`))
+		case r.Method == http.MethodPost && query.Get("uploads") == "":
+			w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut && len(query.Get("partNumber")) > 0:
+			w.Write([]byte(`<CopyPartResult><ETag>"etag-` + query.Get("partNumber") + `"</ETag></CopyPartResult>`))
+		case r.Method == http.MethodPost && len(query.Get("uploadId")) > 0:
+			w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`))
+		default:
+			w.Write([]byte(`<CopyObjectResult><ETag>"copied"</ETag></CopyObjectResult>`))
+		}
+		requests = append(requests, r)
+	}))
+	defer server.Close()
+
+	storage, err := util.NewStorage(&util.S3Accessor{
+		Backend:        util.StorageBackendS3,
+		Bucket:         "bucket",
+		Token:          "token",
+		Secret:         "secret",
+		Endpoint:       server.URL,
+		ForcePathStyle: true,
+		DisableSSL:     true,
+	})
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+	ctx := context.Background()
+
+	// a plain copy lets s3 copy the headers and metadata
+	err = storage.Copy(ctx, "bucket", "a b.jpg", "bucket", "b.jpg", util.CopyOptions{})
+	if err != nil {
+		t.Fatalf("failed to copy: %s", err)
+	}
+	copied := requests[len(requests)-1]
+	if copied.Header.Get("X-Amz-Metadata-Directive") != "COPY" || len(copied.Header.Get("Content-Type")) > 0 || copied.Header.Get("X-Amz-Copy-Source") != "bucket/a%20b.jpg" {
+		t.Fatalf("expected a copy that keeps everything: %+v", copied.Header)
+	}
+
+	// changing a header sends the rest from the source
+	err = storage.Copy(ctx, "bucket", "a.jpg", "bucket", "b.jpg", util.CopyOptions{CacheControl: "no-cache", Metadata: map[string]string{"album": "2020"}})
+	if err != nil {
+		t.Fatalf("failed to copy with headers: %s", err)
+	}
+	copied = requests[len(requests)-1]
+	if copied.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" || copied.Header.Get("Content-Type") != "image/jpeg" || copied.Header.Get("Cache-Control") != "no-cache" ||
+		copied.Header.Get("X-Amz-Meta-Owner") != "me" || copied.Header.Get("X-Amz-Meta-Album") != "2020" {
+		t.Fatalf("expected a copy with changed headers, and the rest kept: %+v", copied.Header)
+	}
+
+	// the trash copy is private, and records the acl
+	_, err = util.CopyToTrash(ctx, storage, "bucket", ".trash", "a.jpg", "me", time.Now())
+	if err != nil {
+		t.Fatalf("failed to copy to trash: %s", err)
+	}
+	copied = requests[len(requests)-1]
+	if copied.Header.Get("X-Amz-Acl") != "private" || copied.Header.Get("X-Amz-Meta-Snapr-Acl") != "public-read" || copied.Header.Get("X-Amz-Meta-Owner") != "me" {
+		t.Fatalf("expected a private trash copy that records the acl: %+v", copied.Header)
+	}
+
+	// a restore gets the acl back, and leaves the trash metadata behind
+	err = util.RestoreObject(ctx, storage, "bucket", ".trash/2020-01-01T00-00-00/a.jpg", "bucket", "a.jpg")
+	if err != nil {
+		t.Fatalf("failed to restore: %s", err)
+	}
+	copied = requests[len(requests)-2]
+	if copied.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" || copied.Header.Get("X-Amz-Acl") != "public-read" || copied.Header.Get("X-Amz-Meta-Owner") != "me" ||
+		len(copied.Header.Get("X-Amz-Meta-Snapr-Acl")) > 0 || len(copied.Header.Get("X-Amz-Meta-Snapr-Original-Key")) > 0 {
+		t.Fatalf("expected a restore with the recorded acl and without the trash metadata: %+v", copied.Header)
+	}
+	if requests[len(requests)-1].Method != http.MethodDelete {
+		t.Fatalf("expected the trash copy to be deleted after the restore")
+	}
+
+	// over the single copy size, objects are copied in parts, which are never under the smallest part size
+	maxCopySize, minPartSize := util.S3MaxCopySize, util.S3MinPartSize
+	defer func() { util.S3MaxCopySize, util.S3MinPartSize = maxCopySize, minPartSize }()
+	util.S3MaxCopySize = 10
+	util.S3MinPartSize = 10
+	objectSize = 25
+	storage.(*util.S3Storage).CopyPartSize = 1
+	requests = nil
+
+	err = storage.Copy(ctx, "bucket", "big.jpg", "bucket", "big-copy.jpg", util.CopyOptions{})
+	if err != nil {
+		t.Fatalf("failed to copy in parts: %s", err)
+	}
+	ranges := map[string]bool{}
+	for _, r := range requests {
+		if len(r.URL.Query().Get("partNumber")) > 0 {
+			ranges[r.Header.Get("X-Amz-Copy-Source-Range")] = true
+		}
+	}
+	created := requests[1]
+	if len(requests) != 6 || !ranges["bytes=0-9"] || !ranges["bytes=10-19"] || !ranges["bytes=20-24"] || created.Header.Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected a copy in 3 parts that keeps the content type: %d requests, ranges %v", len(requests), ranges)
+	}
+	if created.Header.Get("X-Amz-Storage-Class") != "STANDARD_IA" || created.Header.Get("X-Amz-Tagging") != "album=2020" {
+		t.Fatalf("expected a copy in parts that keeps the storage class and tags: %+v", created.Header)
+	}
+}
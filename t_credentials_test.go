@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"snapr/util"
+)
+
+// Test10CredentialChain signs requests to a fake s3 endpoint with keys from a profile,
+// from a credential_process, and from the environment, and checks the keys that were used
+func Test10CredentialChain(t *testing.T) {
+
+	// the access key of the last request
+	var mutex sync.Mutex
+	var accessKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		accessKey = ""
+		if parts := strings.SplitN(r.Header.Get("Authorization"), "Credential=", 2); len(parts) == 2 {
+			accessKey = strings.SplitN(parts[1], "/", 2)[0]
+		}
+		w.Header().Set("Content-Length", "7")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// shared files in a temp dir, and nothing from the real environment
+	dir, err := ioutil.TempDir("", "snapr-credentials")
+	if err != nil {
+		t.Fatalf("could not make temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	credentialsFile := filepath.Join(dir, "credentials")
+	configFile := filepath.Join(dir, "config")
+	ioutil.WriteFile(credentialsFile, []byte("[tester]\naws_access_key_id = PROFILEKEY\naws_secret_access_key = profilesecret\n"), 0600)
+	processFile := filepath.Join(dir, "process.json")
+	ioutil.WriteFile(processFile, []byte(`{"Version": 1, "AccessKeyId": "PROCESSKEY", "SecretAccessKey": "processsecret"}`), 0600)
+	ioutil.WriteFile(configFile, []byte("[profile process]\ncredential_process = cat "+processFile+"\n"), 0600)
+
+	env := map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": credentialsFile,
+		"AWS_CONFIG_FILE":             configFile,
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_PROFILE":                 "",
+	}
+	for name, value := range env {
+		if old, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Setenv(name, value)
+	}
+
+	headWith := func(accessor *util.S3Accessor) (string, error) {
+		accessor.Backend = util.StorageBackendS3
+		accessor.Bucket = "bucket"
+		accessor.Endpoint = server.URL
+		accessor.ForcePathStyle = true
+		accessor.DisableSSL = true
+		accessor.Retry = util.RetryPolicy{MaxAttempts: 1}
+		storage, err := util.NewStorage(accessor)
+		if err != nil {
+			return "", err
+		}
+		_, err = storage.Head(context.Background(), "bucket", "t_test.jpg")
+		mutex.Lock()
+		defer mutex.Unlock()
+		return accessKey, err
+	}
+
+	cases := []struct {
+		name     string
+		accessor *util.S3Accessor
+		env      string
+		expected string
+	}{
+		{"token and secret", &util.S3Accessor{Token: "TOKEN", Secret: "secret"}, "", "TOKEN"},
+		{"profile over token and secret", &util.S3Accessor{Token: "TOKEN", Secret: "secret", Profile: "tester"}, "", "PROFILEKEY"},
+		{"credential process", &util.S3Accessor{Profile: "process"}, "", "PROCESSKEY"},
+		{"aws env vars", &util.S3Accessor{}, "ENVKEY", "ENVKEY"},
+	}
+	for _, c := range cases {
+		os.Setenv("AWS_ACCESS_KEY_ID", c.env)
+		os.Setenv("AWS_SECRET_ACCESS_KEY", c.env)
+		key, err := headWith(c.accessor)
+		if err != nil {
+			t.Fatalf("%s: failed to head: %s", c.name, err)
+		}
+		if key != c.expected {
+			t.Fatalf("%s: expected requests signed with %s, got %s", c.name, c.expected, key)
+		}
+	}
+	os.Setenv("AWS_ACCESS_KEY_ID", "")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	// half of a key pair is a mistake
+	if _, err := headWith(&util.S3Accessor{Token: "TOKEN"}); err == nil {
+		t.Fatalf("expected an error for a token without a secret")
+	}
+
+	// a profile that does not exist is not silently replaced
+	if _, err := headWith(&util.S3Accessor{Profile: "missing"}); err == nil {
+		t.Fatalf("expected an error for a missing profile")
+	}
+}
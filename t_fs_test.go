@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"snapr/cli"
+	"snapr/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Test4FSBackendCommands runs the bucket commands against a local directory
+// so that they can be tested without aws credentials
+func Test4FSBackendCommands(t *testing.T) {
+
+	// ensure the temp directory exists
+	_, testTempDir, err := ensureTestDir("test-4")
+	if err != nil {
+		t.Errorf("could not create test temp dir: %s", testTempDir)
+	}
+	// clean up on fail
+	defer cleanupTestDir(testTempDir)
+
+	// the "bucket" and the dirs we move files in and out of
+	bucketDir := filepath.Join(testTempDir, "bucket")
+	inDir := filepath.Join(testTempDir, "in")
+	outDir := filepath.Join(testTempDir, "out")
+	for _, dir := range []string{bucketDir, inDir, outDir} {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			t.Fatalf("could not create test dir: %s", dir)
+		}
+	}
+
+	// ensure the test files exist
+	testFiles := []string{"t_test.jpg", "t_testy.jpg"}
+	for _, testFile := range testFiles {
+		_, err = copyFile("t_test.jpg", filepath.Join(inDir, testFile))
+		if err != nil {
+			t.Fatalf("could not copy test image file")
+		}
+	}
+
+	// root options for the local bucket
+	ropts := &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, JournalDir: filepath.Join(testTempDir, "journal"), HistoryDir: filepath.Join(testTempDir, "history")}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	ctx := context.Background()
+
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+
+	// checks that every test file is (or is not) under a key
+	confirmKeys := func(step, dir string, expectExists bool) {
+		for _, testFile := range testFiles {
+			key := util.JoinS3Path(dir, testFile)
+			_, err := storage.Head(ctx, ropts.Bucket, key)
+			if exists := err == nil; exists != expectExists {
+				t.Errorf(wrapTestError(step, ropts.Bucket, fmt.Sprintf("expected existence of '%s' to be %t", key, expectExists)))
+			}
+		}
+	}
+
+	logrus.Infof("TEST (upload)")
+	_, err = cli.UploadCmdRunE(ctx, ropts, &cli.UploadCmdOptions{
+		InDir:       inDir,
+		UploadLimit: 10,
+		S3Dir:       "uploads",
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("upload", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	confirmKeys("upload", "uploads", true)
+
+	logrus.Infof("TEST (list)")
+	objects, folders, err := storage.List(ctx, ropts.Bucket, "", true)
+	if err != nil {
+		t.Errorf(wrapTestError("list", ropts.Bucket, fmt.Sprintf("list failed: %s", err)))
+	}
+	if len(objects) != 0 || len(folders) != 1 || folders[0].Key != "uploads/" {
+		t.Errorf(wrapTestError("list", ropts.Bucket, fmt.Sprintf("expected only the 'uploads/' folder, got %d files and %d folders", len(objects), len(folders))))
+	}
+
+	logrus.Infof("TEST (rename)")
+	_, err = cli.RenameCmdRunE(ctx, ropts, &cli.RenameCmdOptions{
+		S3SourceKey: "uploads",
+		S3DestKey:   "renamed",
+		SrcIsDir:    true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("rename", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	confirmKeys("rename", "uploads", false)
+	confirmKeys("rename", "renamed", true)
+
+	logrus.Infof("TEST (download)")
+	_, err = cli.DownloadCmdRunE(ctx, ropts, &cli.DownloadCmdOptions{
+		S3Key:  "renamed",
+		IsDir:  true,
+		OutDir: outDir,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("download", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	for _, testFile := range testFiles {
+		_, err = os.Stat(filepath.Join(outDir, "renamed", testFile))
+		if err != nil {
+			t.Errorf(wrapTestError("download", ropts.Bucket, fmt.Sprintf("file not downloaded: %s", err)))
+		}
+	}
+
+	logrus.Infof("TEST (delete dry run)")
+	ropts.DryRun = true
+	_, err = cli.DeleteCmdRunE(ctx, ropts, &cli.DeleteCmdOptions{
+		S3Key: "renamed",
+		IsDir: true,
+	})
+	ropts.DryRun = false
+	if err != nil {
+		t.Errorf(wrapTestError("delete dry run", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	confirmKeys("delete dry run", "renamed", true)
+
+	logrus.Infof("TEST (delete)")
+	_, err = cli.DeleteCmdRunE(ctx, ropts, &cli.DeleteCmdOptions{
+		S3Key: "renamed",
+		IsDir: true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("delete", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	confirmKeys("delete", "renamed", false)
+
+	logrus.Infof("TEST (trash restore)")
+	_, err = cli.TrashRestoreCmdRunE(ctx, ropts, &cli.TrashRestoreCmdOptions{
+		S3Key: "renamed",
+		IsDir: true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("trash restore", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	confirmKeys("trash restore", "renamed", true)
+
+	logrus.Infof("TEST (trash keys)")
+	deletedAt := time.Date(2024, 5, 1, 10, 0, 0, 1000, time.UTC)
+	first := util.TrashKey(ropts.TrashDir, deletedAt, "renamed/t_test.jpg")
+	second := util.TrashKey(ropts.TrashDir, deletedAt.Add(time.Millisecond), "renamed/t_test.jpg")
+	if first == second {
+		t.Errorf(wrapTestError("trash keys", ropts.Bucket, fmt.Sprintf("expected deletes in the same second to get their own keys: %s", first)))
+	}
+	entry, err := util.ParseTrashKey(ropts.TrashDir, first)
+	if err != nil || !entry.DeletedAt.Equal(deletedAt) || entry.OriginalKey != "renamed/t_test.jpg" {
+		t.Errorf(wrapTestError("trash keys", ropts.Bucket, fmt.Sprintf("unexpected trash key parse: %+v, %v", entry, err)))
+	}
+	// older keys have no fraction of a second
+	entry, err = util.ParseTrashKey(ropts.TrashDir, util.JoinS3Path(ropts.TrashDir, "2024-05-01T10-00-00/renamed/t_test.jpg"))
+	if err != nil || !util.MatchTrashTime(deletedAt, entry.DeletedAt) {
+		t.Errorf(wrapTestError("trash keys", ropts.Bucket, fmt.Sprintf("unexpected older trash key parse: %+v, %v", entry, err)))
+	}
+
+	logrus.Infof("TEST (trash purge)")
+	_, err = cli.DeleteCmdRunE(ctx, ropts, &cli.DeleteCmdOptions{
+		S3Key: "renamed",
+		IsDir: true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("trash purge", ropts.Bucket, fmt.Sprintf("delete command failed: %s", err)))
+	}
+	_, err = cli.TrashPurgeCmdRunE(ctx, ropts, &cli.TrashPurgeCmdOptions{OlderThan: "0s"})
+	if err != nil {
+		t.Errorf(wrapTestError("trash purge", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	trashed, _, err := storage.List(ctx, ropts.Bucket, util.EnsureS3DirPath(ropts.TrashDir), false)
+	if err != nil || len(trashed) != 0 {
+		t.Errorf(wrapTestError("trash purge", ropts.Bucket, fmt.Sprintf("expected an empty trash, got %d objects", len(trashed))))
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 
@@ -111,3 +112,9 @@ func copyFile(existingRelativePath, newRelativePath string) (bytesCopied int64,
 	// done
 	return
 }
+
+// hasQuery tells if a query has a key, even without a value, like `?acl`
+func hasQuery(query url.Values, key string) bool {
+	_, ok := query[key]
+	return ok
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snapr/cli"
+	"snapr/util"
+)
+
+// Test7RateLimits uploads through a shared bandwidth limit
+// and checks that the workers together stay under it
+func Test7RateLimits(t *testing.T) {
+
+	// ensure the temp directory exists
+	_, testTempDir, err := ensureTestDir("test-7")
+	if err != nil {
+		t.Errorf("could not create test temp dir: %s", testTempDir)
+	}
+	// clean up on fail
+	defer cleanupTestDir(testTempDir)
+
+	bucketDir := filepath.Join(testTempDir, "bucket")
+	inDir := filepath.Join(testTempDir, "in")
+	for _, dir := range []string{bucketDir, inDir} {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			t.Fatalf("could not create test dir: %s", dir)
+		}
+	}
+
+	// 4 copies of the 7 KB test image
+	for i := 0; i < 4; i++ {
+		_, err = copyFile("t_test.jpg", filepath.Join(inDir, fmt.Sprintf("t_test_%d.jpg", i)))
+		if err != nil {
+			t.Fatalf("could not copy test image file")
+		}
+	}
+
+	// 20 KiB/s lets the first second of bytes through at once, and the rest after
+	ropts := &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, BandwidthLimit: 0.02, RateLimit: 100, Concurrency: 4}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	ctx := context.Background()
+
+	started := time.Now()
+	report, err := cli.UploadCmdRunE(ctx, ropts, &cli.UploadCmdOptions{InDir: inDir, S3Dir: "limited", UploadLimit: 10})
+	if err != nil {
+		t.Fatalf("failed to upload: %s", err)
+	}
+	if len(report.Succeeded) != 4 {
+		t.Fatalf("expected 4 uploads: %+v", report.Succeeded)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the bandwidth limit to slow the upload down, took %s", elapsed)
+	}
+
+	// downloads share the limit while they move, so workers that start together still wait
+	ropts = &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, BandwidthLimit: 0.02}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+	started = time.Now()
+	eg, egCtx := util.NewErrGroup(ctx)
+	for i := 0; i < 4; i++ {
+		i := i
+		eg.Go(func() error {
+			return storage.Download(egCtx, ropts.Bucket, fmt.Sprintf("limited/t_test_%d.jpg", i), filepath.Join(testTempDir, fmt.Sprintf("out_%d.jpg", i)))
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to download: %s", err)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the bandwidth limit to slow the downloads down, took %s", elapsed)
+	}
+
+	// copies on the local filesystem move the bytes too, so they share the limit as well
+	ropts = &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, BandwidthLimit: 0.02}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	storage, err = util.NewStorage(ropts.S3Config)
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+	started = time.Now()
+	eg, egCtx = util.NewErrGroup(ctx)
+	for i := 0; i < 4; i++ {
+		i := i
+		eg.Go(func() error {
+			return storage.Copy(egCtx, ropts.Bucket, fmt.Sprintf("limited/t_test_%d.jpg", i), ropts.Bucket, fmt.Sprintf("copied/t_test_%d.jpg", i), util.CopyOptions{})
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatalf("failed to copy: %s", err)
+	}
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Fatalf("expected the bandwidth limit to slow the copies down, took %s", elapsed)
+	}
+
+	// every s3 request waits for the rate limit, retries too
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`))
+			return
+		}
+		w.Header().Set("Content-Length", "7")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	storage, err = util.NewStorage(&util.S3Accessor{
+		Backend:           util.StorageBackendS3,
+		Bucket:            "bucket",
+		Token:             "token",
+		Secret:            "secret",
+		Endpoint:          server.URL,
+		ForcePathStyle:    true,
+		DisableSSL:        true,
+		RequestsPerSecond: 2,
+		Retry:             util.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("could not get s3 storage backend: %s", err)
+	}
+
+	// the first head is throttled and retried, which uses up the burst of 2, so the second head waits
+	started = time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := storage.Head(ctx, "bucket", "t_test.jpg"); err != nil {
+			t.Fatalf("expected the head to succeed: %s", err)
+		}
+	}
+	if elapsed := time.Since(started); atomic.LoadInt32(&requests) != 3 || elapsed < 400*time.Millisecond {
+		t.Fatalf("expected 3 requests, with the retry waiting for the rate limit: %d requests in %s", requests, elapsed)
+	}
+
+	// a cancelled wait gives up right away
+	limiter := util.NewRateLimiter(1)
+	limiter.Wait(ctx, 1)
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.Wait(cancelledCtx, 10); err == nil {
+		t.Fatalf("expected a cancelled wait to fail")
+	}
+}
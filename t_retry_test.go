@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"snapr/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Test8RetryTransientErrors runs requests against a fake s3 endpoint that throttles
+// and checks that they are retried, and counted, and that permanent errors are not
+func Test8RetryTransientErrors(t *testing.T) {
+
+	// the first two requests for every key are throttled
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch {
+		case r.URL.Path == "/bucket/missing.jpg":
+			w.WriteHeader(http.StatusNotFound)
+		case n <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`))
+		default:
+			w.Header().Set("Content-Length", "7")
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	storage, err := util.NewStorage(&util.S3Accessor{
+		Backend:        util.StorageBackendS3,
+		Bucket:         "bucket",
+		Token:          "token",
+		Secret:         "secret",
+		Endpoint:       server.URL,
+		ForcePathStyle: true,
+		DisableSSL:     true,
+		Retry:          util.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+
+	// retries are logged to the logger of the context, and not to the global one
+	var logged, globalLogged bytes.Buffer
+	log := logrus.New()
+	log.SetOutput(&logged)
+	logrus.SetOutput(&globalLogged)
+	defer logrus.SetOutput(os.Stderr)
+
+	report := util.NewOperationReport("head")
+	ctx := util.WithLogger(util.WithOperationReport(context.Background(), report), log)
+
+	// throttled twice, then found
+	head, err := storage.Head(ctx, "bucket", "t_test.jpg")
+	if err != nil {
+		t.Fatalf("expected the head to succeed after retries: %s", err)
+	}
+	if head.Size != 7 || report.Retries != 2 || atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("expected 2 retries and 3 requests: %d retries, %d requests, size %d", report.Retries, requests, head.Size)
+	}
+
+	if strings.Count(logged.String(), "RETRY") != 2 || globalLogged.Len() > 0 {
+		t.Fatalf("expected 2 retries logged to the context logger only: %q, global %q", logged.String(), globalLogged.String())
+	}
+
+	// not found is not retried
+	atomic.StoreInt32(&requests, 10)
+	_, err = storage.Head(ctx, "bucket", "missing.jpg")
+	if err == nil {
+		t.Fatalf("expected a missing key to fail")
+	}
+	if report.Retries != 2 || atomic.LoadInt32(&requests) != 11 {
+		t.Fatalf("expected no retries for a missing key: %d retries, %d requests", report.Retries, requests)
+	}
+
+	// delays double up to the max, and jitter only takes time off
+	policy := util.RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+	for retry, longest := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		delay := policy.Delay(retry)
+		if delay > longest || delay < longest/2 {
+			t.Fatalf("unexpected delay for retry %d: %s", retry, delay)
+		}
+	}
+
+	// a zero jitter is the default, and only no jitter waits the exact delay
+	policy = util.RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	if delay := policy.Delay(0); delay > 100*time.Millisecond || delay < 50*time.Millisecond {
+		t.Fatalf("unexpected delay with the default jitter: %s", delay)
+	}
+	policy.NoJitter = true
+	if delay := policy.Delay(0); delay != 100*time.Millisecond {
+		t.Fatalf("unexpected delay with no jitter: %s", delay)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -93,6 +94,7 @@ func Test1SnapCommand(t *testing.T) {
 }
 
 func testCommandSnap(t *testing.T, testTempDir string, tests []snapTest) {
+	ctx := context.Background()
 
 	// get the list of logged in users
 	usersOutput, err := util.OSUsers()
@@ -112,7 +114,7 @@ func testCommandSnap(t *testing.T, testTempDir string, tests []snapTest) {
 		testUseScreenshot := test.cmdOpts.UseScreenshot
 
 		// run test command
-		err = cli.SnapCmdRunE(testRootCmdOpts, test.cmdOpts)
+		err = cli.SnapCmdRunE(ctx, testRootCmdOpts, test.cmdOpts)
 		logrus.Infof("Command Ran")
 
 		// what was expected vs. what was got?
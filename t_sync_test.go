@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"snapr/cli"
+	"snapr/util"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Test5SyncCommand syncs a directory to a local bucket and back
+func Test5SyncCommand(t *testing.T) {
+
+	// ensure the temp directory exists
+	_, testTempDir, err := ensureTestDir("test-5")
+	if err != nil {
+		t.Errorf("could not create test temp dir: %s", testTempDir)
+	}
+	// clean up on fail
+	defer cleanupTestDir(testTempDir)
+
+	// the "bucket" and the dirs we sync in and out of
+	bucketDir := filepath.Join(testTempDir, "bucket")
+	inDir := filepath.Join(testTempDir, "in")
+	outDir := filepath.Join(testTempDir, "out")
+	for _, dir := range []string{bucketDir, filepath.Join(inDir, "sub")} {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			t.Fatalf("could not create test dir: %s", dir)
+		}
+	}
+
+	// ensure the test files exist
+	for _, testFile := range []string{"t_test.jpg", "sub/t_testy.jpg"} {
+		_, err = copyFile("t_test.jpg", filepath.Join(inDir, testFile))
+		if err != nil {
+			t.Fatalf("could not copy test image file")
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(inDir, "skip.tmp"), []byte("skip"), 0600)
+	if err != nil {
+		t.Fatalf("could not write test file")
+	}
+
+	// root options for the local bucket
+	ropts := &cli.RootCmdOptions{Bucket: util.FSBucketScheme + bucketDir, JournalDir: filepath.Join(testTempDir, "journal"), HistoryDir: filepath.Join(testTempDir, "history")}
+	ropts = ropts.SetupS3ConfigFromRootArgs()
+	ctx := context.Background()
+
+	storage, err := util.NewStorage(ropts.S3Config)
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+
+	// counts the objects under a key
+	countKeys := func(key string) int {
+		objects, _, err := storage.List(ctx, ropts.Bucket, key, false)
+		if err != nil {
+			t.Errorf("could not list key: %s: %s", key, err)
+		}
+		return len(objects)
+	}
+
+	logrus.Infof("TEST (dry run)")
+	ropts.DryRun = true
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		Dir:       inDir,
+		S3DestKey: "synced",
+	})
+	ropts.DryRun = false
+	if err != nil {
+		t.Errorf(wrapTestError("dry run", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	if count := countKeys("synced/"); count != 0 {
+		t.Errorf(wrapTestError("dry run", ropts.Bucket, fmt.Sprintf("expected nothing synced, got %d", count)))
+	}
+
+	logrus.Infof("TEST (upload with exclude)")
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		Dir:       inDir,
+		S3DestKey: "synced",
+		Excludes:  []string{"*.tmp"},
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("upload", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	if count := countKeys("synced/"); count != 2 {
+		t.Errorf(wrapTestError("upload", ropts.Bucket, fmt.Sprintf("expected 2 synced, got %d", count)))
+	}
+
+	logrus.Infof("TEST (upload with delete)")
+	err = os.Remove(filepath.Join(inDir, "sub", "t_testy.jpg"))
+	if err != nil {
+		t.Fatalf("could not remove test file")
+	}
+	report, err := cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		Dir:       inDir,
+		S3DestKey: "synced",
+		Excludes:  []string{"*.tmp"},
+		Delete:    true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("delete", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	} else if len(report.Succeeded) != 1 || len(report.Skipped) != 1 || len(report.Failed) != 0 {
+		t.Errorf(wrapTestError("delete", ropts.Bucket, fmt.Sprintf("unexpected report: %s", report.Summary())))
+	}
+	if count := countKeys("synced/"); count != 1 {
+		t.Errorf(wrapTestError("delete", ropts.Bucket, fmt.Sprintf("expected 1 synced, got %d", count)))
+	}
+	if count := countKeys(ropts.TrashDir + "/"); count != 1 {
+		t.Errorf(wrapTestError("delete", ropts.Bucket, fmt.Sprintf("expected the extra to be in the trash, got %d", count)))
+	}
+
+	logrus.Infof("TEST (undo delete)")
+	history := &util.History{Dir: ropts.HistoryDir, Bucket: ropts.Bucket}
+	entries, err := history.List(ctx, 1)
+	if err != nil || len(entries) != 1 || len(entries[0].Moves) != 1 || entries[0].Moves[0].SrcKey != "synced/sub/t_testy.jpg" {
+		t.Fatalf(wrapTestError("undo delete", ropts.Bucket, fmt.Sprintf("expected the trashed extra in the history: %+v, %v", entries, err)))
+	}
+	_, err = cli.UndoCmdRunE(ctx, ropts, &cli.UndoCmdOptions{ID: entries[0].ID})
+	if err != nil {
+		t.Errorf(wrapTestError("undo delete", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	if count := countKeys("synced/"); count != 2 {
+		t.Errorf(wrapTestError("undo delete", ropts.Bucket, fmt.Sprintf("expected the extra back, got %d synced", count)))
+	}
+	// and trash it again for what follows
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		Dir:       inDir,
+		S3DestKey: "synced",
+		Excludes:  []string{"*.tmp"},
+		Delete:    true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("undo delete", ropts.Bucket, fmt.Sprintf("sync command failed: %s", err)))
+	}
+
+	logrus.Infof("TEST (permanent without delete, should fail)")
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		Dir:       inDir,
+		S3DestKey: "synced",
+		Permanent: true,
+	})
+	if err == nil {
+		t.Errorf(wrapTestError("permanent", ropts.Bucket, "command succeeded when expected to fail"))
+	}
+
+	logrus.Infof("TEST (download)")
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		S3SrcKey: "synced",
+		Dir:      outDir,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("download", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	_, err = os.Stat(filepath.Join(outDir, "t_test.jpg"))
+	if err != nil {
+		t.Errorf(wrapTestError("download", ropts.Bucket, fmt.Sprintf("file not downloaded: %s", err)))
+	}
+
+	logrus.Infof("TEST (upload with permanent delete)")
+	err = os.Remove(filepath.Join(inDir, "t_test.jpg"))
+	if err != nil {
+		t.Fatalf("could not remove test file")
+	}
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		Dir:       inDir,
+		S3DestKey: "synced",
+		Excludes:  []string{"*.tmp"},
+		Delete:    true,
+		Permanent: true,
+	})
+	if err != nil {
+		t.Errorf(wrapTestError("permanent delete", ropts.Bucket, fmt.Sprintf("command failed: %s", err)))
+	}
+	if count := countKeys("synced/"); count != 0 {
+		t.Errorf(wrapTestError("permanent delete", ropts.Bucket, fmt.Sprintf("expected nothing synced, got %d", count)))
+	}
+	if count := countKeys(ropts.TrashDir + "/"); count != 1 {
+		t.Errorf(wrapTestError("permanent delete", ropts.Bucket, fmt.Sprintf("expected nothing more in the trash, got %d", count)))
+	}
+
+	logrus.Infof("TEST (overlapping keys, should fail)")
+	_, err = cli.SyncCmdRunE(ctx, ropts, &cli.SyncCmdOptions{
+		S3SrcKey:  "synced",
+		S3DestKey: "synced/again",
+	})
+	if err == nil {
+		t.Errorf(wrapTestError("overlap", ropts.Bucket, "command succeeded when expected to fail"))
+	}
+}
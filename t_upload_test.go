@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -67,6 +68,7 @@ var uploadCommandTests = []uploadTest{
 }
 
 func Test2CommandUpload(t *testing.T) {
+	ctx := context.Background()
 
 	// ensure the temp directory exists
 	_, testTempDir, err := ensureTestDir("test-2")
@@ -108,7 +110,7 @@ func Test2CommandUpload(t *testing.T) {
 		testUploadLimit := test.cmdOpts.UploadLimit
 
 		// run test command
-		err := cli.UploadCmdRunE(testRootCmdOpts, test.cmdOpts)
+		_, err := cli.UploadCmdRunE(ctx, testRootCmdOpts, test.cmdOpts)
 		logrus.Infof("Command Ran")
 
 		// what was expected vs. what was got?
@@ -176,7 +178,7 @@ func Test2CommandUpload(t *testing.T) {
 				keyToConfirm = filepath.Base(keyToConfirm)
 
 				// check if the file exists in aws
-				exists, err := util.CheckS3ObjectExists(s3Client, testRootCmdOpts.Bucket, keyToConfirm)
+				exists, err := util.CheckS3ObjectExists(ctx, s3Client, testRootCmdOpts.Bucket, keyToConfirm)
 				if err != nil {
 					logrus.Warnf("check file exists in aws: %s", err)
 				}
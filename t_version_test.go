@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"snapr/cli"
+	"snapr/util"
+)
+
+// Test14Version checks the build metadata in the version, the serve footer and the User-Agent sent to s3
+func Test14Version(t *testing.T) {
+
+	version, commit, buildDate := util.Version, util.Commit, util.BuildDate
+	defer func() { util.Version, util.Commit, util.BuildDate = version, commit, buildDate }()
+	util.Version, util.Commit, util.BuildDate = "1.2.3", "abc1234", "2006-01-02T15:04:05Z"
+
+	info := util.GetVersionInfo()
+	if info.Version != "1.2.3" || info.Commit != "abc1234" || info.BuildMode != util.Build.Mode || len(info.GoVersion) == 0 {
+		t.Fatalf("expected the version from ldflags: %+v", info)
+	}
+
+	// the serve footer
+	templates, err := cli.ParseTemplates()
+	if err != nil {
+		t.Fatalf("failed to parse templates: %s", err)
+	}
+	var page bytes.Buffer
+	err = templates.ExecuteTemplate(&page, "page-end", nil)
+	if err != nil || !strings.Contains(page.String(), "snapr 1.2.3 (commit abc1234") {
+		t.Fatalf("expected the version in the footer: %s, %v", page.String(), err)
+	}
+
+	// the user agent of s3 requests
+	var mutex sync.Mutex
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		userAgent = r.Header.Get("User-Agent")
+		w.Header().Set("Content-Length", "7")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	storage, err := util.NewStorage(&util.S3Accessor{
+		Backend:        util.StorageBackendS3,
+		Bucket:         "bucket",
+		Token:          "token",
+		Secret:         "secret",
+		Endpoint:       server.URL,
+		ForcePathStyle: true,
+		DisableSSL:     true,
+	})
+	if err != nil {
+		t.Fatalf("could not get storage backend: %s", err)
+	}
+	_, err = storage.Head(context.Background(), "bucket", "t_test.jpg")
+	if err != nil {
+		t.Fatalf("failed to head: %s", err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !strings.Contains(userAgent, info.UserAgent()) {
+		t.Fatalf("expected the user agent to name the binary: %s", userAgent)
+	}
+}
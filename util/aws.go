@@ -1,36 +1,94 @@
 package util
 
 import (
-	"bytes"
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/sirupsen/logrus"
 )
 
 // S3Accessor describes how to access a bucket in aws s3
+// or in an s3 compatible service, like MinIO, Ceph or Wasabi
 type S3Accessor struct {
-	Bucket string
-	Region string
-	Token  string
-	Secret string
+	Backend        string
+	Bucket         string
+	Region         string
+	Token          string
+	Secret         string
+	Endpoint       string
+	ForcePathStyle bool
+	DisableSSL     bool
+	CABundle       string
+
+	// more credentials
+	// the session token goes with temporary keys
+	// the profile is a named profile in the shared aws config and credentials files
+	SessionToken string
+	Profile      string
+
+	// multipart transfers
+	// part size is in MiB
+	PartSize        int64
+	PartConcurrency int
+
+	// limits shared by every storage backend made from this accessor
+	// bandwidth is in MiB per second
+	RequestsPerSecond float64
+	BandwidthMBps     float64
+
+	// how requests that failed for a passing reason are tried again
+	Retry RetryPolicy
+
+	limitersOnce sync.Once
+	requests     *RateLimiter
+	bytes        *RateLimiter
+}
+
+// limiters gets the request and bandwidth limiters, which are nil when there is no limit
+func (config *S3Accessor) limiters() (*RateLimiter, *RateLimiter) {
+	config.limitersOnce.Do(func() {
+		config.requests = NewRateLimiter(config.RequestsPerSecond)
+		config.bytes = NewRateLimiter(config.BandwidthMBps * 1024 * 1024)
+	})
+	return config.requests, config.bytes
 }
 
 // S3Object is a wrapper for an aws object
 type S3Object struct {
-	Bytes     []byte
-	Base64    string
-	Key       string
-	Extension string
+	Bytes     []byte `json:"-"`
+	Base64    string `json:"-"`
+	Key       string `json:"key"`
+	Extension string `json:"extension"`
+
+	// from the object listing
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	StorageClass string    `json:"storage_class,omitempty"`
+
+	// from a head request
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	ContentEncoding    string            `json:"content_encoding,omitempty"`
+	ContentLanguage    string            `json:"content_language,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
 }
 
 // S3Directory is a wrapper for an aws folder
@@ -42,22 +100,226 @@ type S3Directory struct {
 func NewS3Client(config *S3Accessor) (*session.Session, *s3.S3, error) {
 	funcTag := "NewS3Client"
 
+	// s3 compatible services do not care about the region, but the sdk does
+	region := config.Region
+	if len(region) == 0 && len(config.Endpoint) > 0 {
+		region = "us-east-1"
+	}
+
 	// new AWS config
 	cfg := aws.NewConfig().
-		WithRegion(config.Region).
-		WithCredentials(credentials.NewStaticCredentials(config.Token, config.Secret, ""))
+		WithRegion(region).
+		WithS3ForcePathStyle(config.ForcePathStyle).
+		WithDisableSSL(config.DisableSSL)
+	cfg = request.WithRetryer(cfg, &s3Retryer{policy: config.Retry})
+
+	// a token and secret given to snapr come first, unless a profile was asked for
+	// otherwise the standard aws chain is used: AWS_* env vars, a web identity token,
+	// the shared credentials and config files (with credential_process and assumed roles),
+	// and then the instance or container role
+	hasKeys := len(config.Token) > 0 || len(config.Secret) > 0
+	if hasKeys && len(config.Profile) == 0 {
+		if len(config.Token) == 0 || len(config.Secret) == 0 {
+			return nil, nil, WrapError(fmt.Errorf("validation error"), funcTag, "both an s3 token and an s3 secret are required, or neither to use the aws credential chain")
+		}
+		cfg = cfg.WithCredentials(credentials.NewStaticCredentials(config.Token, config.Secret, config.SessionToken))
+	}
+
+	// talk to something other than aws
+	if len(config.Endpoint) > 0 {
+		cfg = cfg.WithEndpoint(config.Endpoint)
+	}
+
+	opts := session.Options{
+		Config:  *cfg,
+		Profile: config.Profile,
+		// read ~/.aws/config too, for regions, roles and credential_process
+		SharedConfigState: session.SharedConfigEnable,
+		// roles that need mfa ask for a code
+		AssumeRoleTokenProvider: stscreds.StdinTokenProvider,
+	}
+
+	// trust a custom certificate authority, like the one on a local MinIO
+	if len(config.CABundle) > 0 {
+		caBundle, err := os.Open(config.CABundle)
+		if err != nil {
+			return nil, nil, WrapError(err, funcTag, fmt.Sprintf("failed to open ca bundle: %s", config.CABundle))
+		}
+		defer caBundle.Close()
+		opts.CustomCABundle = caBundle
+	}
 
 	// get a new AWS session
-	sesh, err := session.NewSession(cfg)
+	sesh, err := session.NewSessionWithOptions(opts)
 	if err != nil {
 		return nil, nil, WrapError(err, funcTag, "failed to open aws session")
 	}
 
+	// name the binary in every request, so that it can be traced in bucket logs
+	userAgent := GetVersionInfo().UserAgent()
+	sesh.Handlers.Build.PushBackNamed(request.NamedHandler{
+		Name: "snapr.UserAgentHandler",
+		Fn: func(req *request.Request) {
+			request.AddToUserAgent(req, userAgent)
+		},
+	})
+
+	// every request waits for the rate limit, including each page, part, batch and retry
+	// a request that stops waiting is not sent
+	if requests, _ := config.limiters(); requests != nil {
+		sesh.Handlers.Send.PushFrontNamed(rateLimitHandler(requests))
+		sesh.Handlers.Send.AfterEachFn = request.HandlerListStopOnError
+	}
+
 	return sesh, s3.New(sesh), nil
 }
 
+// S3CredentialsSource gets the name of the provider that the credentials come from, like EnvConfigProvider or SharedConfigCredentials
+// the credentials are resolved, so this fails when there are none
+func S3CredentialsSource(config *S3Accessor) (string, error) {
+	funcTag := "S3CredentialsSource"
+
+	sesh, _, err := NewS3Client(config)
+	if err != nil {
+		return "", WrapError(err, funcTag, "failed to get s3 client")
+	}
+	value, err := sesh.Config.Credentials.Get()
+	if err != nil {
+		return "", WrapError(err, funcTag, "failed to get credentials")
+	}
+	return value.ProviderName, nil
+}
+
+// S3BucketRegion gets the region that the bucket of the accessor is in
+func S3BucketRegion(ctx context.Context, config *S3Accessor) (string, error) {
+	funcTag := "S3BucketRegion"
+
+	sesh, _, err := NewS3Client(config)
+	if err != nil {
+		return "", WrapError(err, funcTag, "failed to get s3 client")
+	}
+	region, err := s3manager.GetBucketRegion(ctx, sesh, config.Bucket, aws.StringValue(sesh.Config.Region))
+	if err != nil {
+		return "", WrapError(err, funcTag, fmt.Sprintf("failed to get bucket region: %s", config.Bucket))
+	}
+	return region, nil
+}
+
+// S3Storage is the aws s3 storage backend
+type S3Storage struct {
+	Client     *s3.S3
+	Uploader   *s3manager.Uploader
+	Downloader *s3manager.Downloader
+
+	// copies over S3MaxCopySize are copied in parts of this size, this many at a time
+	CopyPartSize    int64
+	CopyConcurrency int
+
+	// the bandwidth limit, which is charged while bytes move, or nil for no limit
+	// the request limit is on the client, so that it sees every request
+	Bytes *RateLimiter
+}
+
+// NewS3Storage gets the aws s3 storage backend described by the accessor
+func NewS3Storage(config *S3Accessor) (*S3Storage, error) {
+	funcTag := "NewS3Storage"
+
+	// get a new aws session
+	_, s3Client, err := NewS3Client(config)
+	if err != nil {
+		return nil, WrapError(err, funcTag, "failed to get new s3 client")
+	}
+
+	// uploads are streamed in parts
+	uploader := s3manager.NewUploaderWithClient(s3Client, func(u *s3manager.Uploader) {
+		if config.PartSize > 0 {
+			u.PartSize = config.PartSize * 1024 * 1024
+		}
+		if config.PartConcurrency > 0 {
+			u.Concurrency = config.PartConcurrency
+		}
+	})
+
+	// large downloads are split into ranged gets, in parallel
+	downloader := s3manager.NewDownloaderWithClient(s3Client, func(d *s3manager.Downloader) {
+		if config.PartSize > 0 {
+			d.PartSize = config.PartSize * 1024 * 1024
+		}
+		if config.PartConcurrency > 0 {
+			d.Concurrency = config.PartConcurrency
+		}
+	})
+
+	// large copies are split into ranged part copies, in parallel
+	copyPartSize := S3CopyPartSize
+	if config.PartSize > 0 {
+		copyPartSize = config.PartSize * 1024 * 1024
+	}
+	copyConcurrency := s3manager.DefaultUploadConcurrency
+	if config.PartConcurrency > 0 {
+		copyConcurrency = config.PartConcurrency
+	}
+
+	_, bytes := config.limiters()
+
+	return &S3Storage{
+		Client:          s3Client,
+		Uploader:        uploader,
+		Downloader:      downloader,
+		CopyPartSize:    copyPartSize,
+		CopyConcurrency: copyConcurrency,
+		Bytes:           bytes,
+	}, nil
+}
+
+// List gets the objects and common keys under a key
+func (s *S3Storage) List(ctx context.Context, bucket, key string, useDelimiter bool) ([]*S3Object, []*S3Directory, error) {
+	return ListS3ObjectsByKey(ctx, s.Client, bucket, key, useDelimiter)
+}
+
+// Head gets the details and metadata of an object
+func (s *S3Storage) Head(ctx context.Context, bucket, key string) (*S3Object, error) {
+	return HeadS3Object(ctx, s.Client, bucket, key)
+}
+
+// ACL gets the canned acl that matches the grants of an object
+func (s *S3Storage) ACL(ctx context.Context, bucket, key string) (string, error) {
+	return GetS3ObjectACL(ctx, s.Client, bucket, key)
+}
+
+// Get downloads a single object into memory
+func (s *S3Storage) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	return DownloadS3Object(ctx, s.Downloader, bucket, key, s.Bytes)
+}
+
+// Download streams a single object to a file
+func (s *S3Storage) Download(ctx context.Context, bucket, key, absFilePath string) error {
+	return DownloadS3ObjectToFile(ctx, s.Downloader, bucket, key, absFilePath, s.Bytes)
+}
+
+// Put streams a single object, no faster than the bandwidth limit
+func (s *S3Storage) Put(ctx context.Context, bucket, acl, key string, body io.Reader) error {
+	return WriteS3Stream(ctx, s.Uploader, bucket, acl, key, limitReader(ctx, body, s.Bytes))
+}
+
+// Copy copies an object to another key, possibly in another bucket
+// objects over S3MaxCopySize are copied in parts
+func (s *S3Storage) Copy(ctx context.Context, srcBucket, srcKey, destBucket, destKey string, opts CopyOptions) error {
+	return CopyS3Object(ctx, s.Client, srcBucket, srcKey, destBucket, destKey, opts, s.CopyPartSize, s.CopyConcurrency)
+}
+
+// Delete removes an object
+func (s *S3Storage) Delete(ctx context.Context, bucket, key string) error {
+	return DeleteS3Object(ctx, s.Client, bucket, key)
+}
+
+// DeleteMany removes many objects, in batches
+func (s *S3Storage) DeleteMany(ctx context.Context, bucket string, keys []string) map[string]error {
+	return DeleteS3Objects(ctx, s.Client, bucket, keys)
+}
+
 // CheckS3ObjectExists confirms that a file exists in an AWS S3
-func CheckS3ObjectExists(s3Client *s3.S3, bucket, key string) (bool, error) {
+func CheckS3ObjectExists(ctx context.Context, s3Client *s3.S3, bucket, key string) (bool, error) {
 	funcTag := "CheckS3ObjectExists"
 
 	// logrus.Infof("Check Key: %s", key)
@@ -69,66 +331,128 @@ func CheckS3ObjectExists(s3Client *s3.S3, bucket, key string) (bool, error) {
 	}
 
 	// check for the object
-	_, err := s3Client.HeadObject(query)
+	_, err := s3Client.HeadObjectWithContext(ctx, query)
 	if err != nil {
-		return false, WrapError(err, funcTag, fmt.Sprintf("failed check s3 object with query: %+v", query))
+		return false, WrapError(err, funcTag, fmt.Sprintf("failed check s3 object with query: %s", QueryString(query)))
 	}
 
 	return true, nil
 }
 
-// WriteS3File sends a single file to an AWS S3 bucket
-func WriteS3File(s3Client *s3.S3, bucket, acl, targetKey string, waffle *WalkedFile) (string, error) {
-	funcTag := "WriteS3File"
+// HeadS3Object gets the details and user metadata of an object in AWS S3
+// metadata keys are lower cased, since s3 does not preserve their case
+func HeadS3Object(ctx context.Context, s3Client *s3.S3, bucket, key string) (*S3Object, error) {
+	funcTag := "HeadS3Object"
+
+	// build the query
+	query := &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	// get the object details
+	res, err := s3Client.HeadObjectWithContext(ctx, query)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed head s3 object with query: %s", QueryString(query)))
+	}
+
+	metadata := map[string]string{}
+	for k, v := range res.Metadata {
+		metadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+
+	return &S3Object{
+		Key:          key,
+		Extension:    strings.ReplaceAll(filepath.Ext(key), ".", ""),
+		Size:         aws.Int64Value(res.ContentLength),
+		ETag:         aws.StringValue(res.ETag),
+		LastModified: aws.TimeValue(res.LastModified),
+		StorageClass: aws.StringValue(res.StorageClass),
+		ContentType:  aws.StringValue(res.ContentType),
+		Metadata:     metadata,
+
+		ContentDisposition: aws.StringValue(res.ContentDisposition),
+		ContentEncoding:    aws.StringValue(res.ContentEncoding),
+		ContentLanguage:    aws.StringValue(res.ContentLanguage),
+		CacheControl:       aws.StringValue(res.CacheControl),
+	}, nil
+}
+
+// s3 groups that acls grant to
+var (
+	s3GroupAllUsers           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	s3GroupAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// GetS3ObjectACL gets the canned acl that matches the grants of an object in AWS S3
+// reads by everyone are "public-read", reads by any aws account are "authenticated-read", and anything else is "private"
+func GetS3ObjectACL(ctx context.Context, s3Client *s3.S3, bucket, key string) (string, error) {
+	funcTag := "GetS3ObjectACL"
 
-	// Open the file for use
-	file, err := os.Open(waffle.Path)
+	// build the query
+	query := &s3.GetObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	// get the object grants
+	res, err := s3Client.GetObjectAclWithContext(ctx, query)
 	if err != nil {
-		return "", WrapError(err, funcTag, "failed to open file")
+		return "", WrapError(err, funcTag, fmt.Sprintf("failed to get s3 object acl with query: %s", QueryString(query)))
 	}
-	defer file.Close()
 
-	// Get file size and read the file content into a buffer
-	fileSize := waffle.FileInfo.Size()
-	buffer := make([]byte, fileSize)
-	file.Read(buffer)
+	acl := s3.ObjectCannedACLPrivate
+	for _, grant := range res.Grants {
+		permission := aws.StringValue(grant.Permission)
+		if grant.Grantee == nil || (permission != s3.PermissionRead && permission != s3.PermissionFullControl) {
+			continue
+		}
+		switch aws.StringValue(grant.Grantee.URI) {
+		case s3GroupAllUsers:
+			return s3.ObjectCannedACLPublicRead, nil
+		case s3GroupAuthenticatedUsers:
+			acl = s3.ObjectCannedACLAuthenticatedRead
+		}
+	}
 
-	return WriteS3Bytes(s3Client, bucket, acl, targetKey, buffer)
+	return acl, nil
 }
 
-// WriteS3Bytes sends a single file to an AWS S3 bucket
-func WriteS3Bytes(s3Client *s3.S3, bucket, acl, targetKey string, buffer []byte) (string, error) {
-	funcTag := "WriteS3Bytes"
+// WriteS3Stream streams a single object to an AWS S3 bucket
+// large bodies are sent as a multipart upload, one part at a time, so they are never fully in memory
+func WriteS3Stream(ctx context.Context, uploader *s3manager.Uploader, bucket, acl, targetKey string, body io.Reader) error {
+	funcTag := "WriteS3Stream"
 
 	// default the acl
 	if len(acl) == 0 {
 		acl = "private"
 	}
 
-	// content length needs to be int64
-	contentLength := int64(len(buffer))
+	// sniff the content type from the first 512 bytes, without consuming them
+	buffered := bufio.NewReaderSize(body, 512)
+	sniff, err := buffered.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to read start of body for key: %s", targetKey))
+	}
 
 	// build the query
-	query := &s3.PutObjectInput{
+	query := &s3manager.UploadInput{
 		Bucket:             aws.String(bucket),
 		Key:                aws.String(targetKey),
 		ACL:                aws.String(acl),
-		Body:               bytes.NewReader(buffer),
-		ContentLength:      aws.Int64(contentLength),
-		ContentType:        aws.String(http.DetectContentType(buffer)),
+		Body:               buffered,
+		ContentType:        aws.String(http.DetectContentType(sniff)),
 		ContentDisposition: aws.String("attachment"),
 		// ServerSideEncryption: aws.String("AES256"),
 	}
 
-	// Config settings: this is where you choose the bucket, filename, content-type etc.
-	// of the file you're uploading.
-	_, err := s3Client.PutObject(query)
+	// the uploader decides between a single put and a multipart upload
+	_, err = uploader.UploadWithContext(ctx, query)
 	if err != nil {
-		return "", WrapError(err, funcTag, fmt.Sprintf("failed to upload file with query: %+v", query))
+		return WrapError(err, funcTag, fmt.Sprintf("failed to upload with query: %s", QueryString(query)))
 	}
 
-	// return if no error
-	return targetKey, nil
+	return nil
 }
 
 // S3Delimiter is the folder delimiter (for us) in AWS S3
@@ -163,7 +487,7 @@ func EnsureS3DirPath(path string) string {
 // ListS3ObjectsByKey sends a single file to an AWS S3 bucket
 // objects are "files"
 // commonKeys are "directories"
-func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool) ([]*S3Object, []*S3Directory, error) {
+func ListS3ObjectsByKey(ctx context.Context, s3Client *s3.S3, bucket, key string, useDelimiter bool) ([]*S3Object, []*S3Directory, error) {
 	funcTag := "ListS3ObjectsByKey"
 
 	// build the input
@@ -177,7 +501,8 @@ func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool)
 		query.Delimiter = aws.String(S3Delimiter)
 	}
 
-	logrus.Infof("Fetching from: %s::%s", *query.Bucket, *query.Prefix)
+	log := contextLogger(ctx)
+	log.Infof("Fetching from: %s::%s", *query.Bucket, *query.Prefix)
 
 	var files []*S3Object
 	var folders []*S3Directory
@@ -186,7 +511,7 @@ func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool)
 	for {
 
 		// get the list of contents
-		response, err := s3Client.ListObjectsV2(query)
+		response, err := s3Client.ListObjectsV2WithContext(ctx, query)
 		if err != nil {
 			// cast error as aws err
 			// custom message for different sitches
@@ -195,12 +520,12 @@ func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool)
 			if ok {
 				switch aerr.Code() {
 				case s3.ErrCodeNoSuchBucket:
-					msg = fmt.Sprintf("%s with query: %+v", s3.ErrCodeNoSuchBucket, query)
+					msg = fmt.Sprintf("%s with query: %s", s3.ErrCodeNoSuchBucket, QueryString(query))
 				default:
-					msg = fmt.Sprintf("unspecified error; ok with query: %+v", query)
+					msg = fmt.Sprintf("unspecified error; ok with query: %s", QueryString(query))
 				}
 			} else {
-				msg = fmt.Sprintf("unspecified error; NOT ok with query: %+v", query)
+				msg = fmt.Sprintf("unspecified error; NOT ok with query: %s", QueryString(query))
 			}
 			return files, folders, WrapError(aerr, funcTag, msg)
 		}
@@ -209,8 +534,12 @@ func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool)
 		// yank the files with extension
 		for _, file := range response.Contents {
 			files = append(files, &S3Object{
-				Key:       *file.Key,
-				Extension: strings.ReplaceAll(filepath.Ext(*file.Key), ".", ""),
+				Key:          *file.Key,
+				Extension:    strings.ReplaceAll(filepath.Ext(*file.Key), ".", ""),
+				Size:         aws.Int64Value(file.Size),
+				ETag:         aws.StringValue(file.ETag),
+				LastModified: aws.TimeValue(file.LastModified),
+				StorageClass: aws.StringValue(file.StorageClass),
 			})
 		}
 
@@ -232,9 +561,9 @@ func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool)
 		if !*response.IsTruncated {
 			msg := fmt.Sprintf("Done fetching. %d files", len(files))
 			if useDelimiter {
-				fmt.Sprintf("%s, %d folders", msg, len(folders))
+				msg = fmt.Sprintf("%s, %d folders", msg, len(folders))
 			}
-			logrus.Infof(msg)
+			log.Infof(msg)
 			break
 		}
 	}
@@ -244,15 +573,13 @@ func ListS3ObjectsByKey(s3Client *s3.S3, bucket, key string, useDelimiter bool)
 }
 
 // DownloadS3Object downaloads a single object from aws s3 bucket
-func DownloadS3Object(s3Client *s3.S3, bucket, key string) ([]byte, error) {
+// parts are written no faster than the limiter allows, which can be nil for no limit
+func DownloadS3Object(ctx context.Context, downloader *s3manager.Downloader, bucket, key string, limiter *RateLimiter) ([]byte, error) {
 	funcTag := "DownloadS3Object"
 
 	// basoically, get a new byte slice to write to
 	buff := &aws.WriteAtBuffer{}
 
-	// get a new s3manager downloader
-	downloader := s3manager.NewDownloaderWithClient(s3Client)
-
 	// build the query
 	query := &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
@@ -260,16 +587,40 @@ func DownloadS3Object(s3Client *s3.S3, bucket, key string) ([]byte, error) {
 	}
 
 	// download the object
-	_, err := downloader.Download(buff, query)
+	_, err := downloader.DownloadWithContext(ctx, limitWriterAt(ctx, buff, limiter), query)
 	if err != nil {
-		return []byte{}, WrapError(err, funcTag, fmt.Sprintf("failed to download to buffer with quer: %+v", query))
+		return []byte{}, WrapError(err, funcTag, fmt.Sprintf("failed to download to buffer with quer: %s", QueryString(query)))
 	}
 
 	return buff.Bytes(), nil
 }
 
+// DownloadS3ObjectToFile streams a single object from aws s3 bucket to a file
+// the object is never fully in memory, and the file only shows up once it is complete
+// parts are written no faster than the limiter allows, which can be nil for no limit
+func DownloadS3ObjectToFile(ctx context.Context, downloader *s3manager.Downloader, bucket, key, absFilePath string, limiter *RateLimiter) error {
+	funcTag := "DownloadS3ObjectToFile"
+
+	// build the query
+	query := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	// download the object, parts are written at their offsets in the file
+	err := WriteFileAtomic(absFilePath, func(file *os.File) error {
+		_, err := downloader.DownloadWithContext(ctx, limitWriterAt(ctx, file, limiter), query)
+		return err
+	})
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to download to file with query: %s", QueryString(query)))
+	}
+
+	return nil
+}
+
 // DeleteS3Object deletes an object from S3 and returns an error, if any
-func DeleteS3Object(s3Client *s3.S3, bucket, key string) error {
+func DeleteS3Object(ctx context.Context, s3Client *s3.S3, bucket, key string) error {
 	funcTag := "DownloadS3Object"
 
 	// build the query
@@ -279,65 +630,315 @@ func DeleteS3Object(s3Client *s3.S3, bucket, key string) error {
 	}
 
 	// remove the object from the bucket
-	_, err := s3Client.DeleteObject(query)
+	_, err := s3Client.DeleteObjectWithContext(ctx, query)
 	if err != nil {
-		return WrapError(err, funcTag, fmt.Sprintf("failed to delete object with query: %+v", query))
+		return WrapError(err, funcTag, fmt.Sprintf("failed to delete object with query: %s", QueryString(query)))
 	}
 
 	return nil
 }
 
-// RenameS3Object renames an object in S3 and returns an error, if any
-// This operation is made on the same bucket
-func RenameS3Object(s3Client *s3.S3, srcBucket, srcKey, destBucket, destKey, acl string) error {
-	funcTag := "RenameS3Object"
+// S3DeleteBatchSize is the most keys that s3 deletes in a single request
+var S3DeleteBatchSize = 1000
 
-	// copy the original object to a new key
-	err := CopyS3Object(s3Client, srcBucket, srcKey, destBucket, destKey, acl)
-	if err != nil {
-		return WrapError(err, funcTag, "failed to delete object")
-	}
+// DeleteS3Objects removes many objects from an AWS S3 bucket, one request per batch of keys
+// it returns the keys that failed, and why
+func DeleteS3Objects(ctx context.Context, s3Client *s3.S3, bucket string, keys []string) map[string]error {
+	funcTag := "DeleteS3Objects"
 
-	// remove the original object from the bucket
-	err = DeleteS3Object(s3Client, srcBucket, srcKey)
-	if err != nil {
-		return WrapError(err, funcTag, "failed to delete original object after copying during rename operation")
+	failed := map[string]error{}
+	for start := 0; start < len(keys); start += S3DeleteBatchSize {
+		end := start + S3DeleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+
+		// build the query
+		// quiet mode only sends back the keys that failed
+		var ids []*s3.ObjectIdentifier
+		for _, key := range batch {
+			ids = append(ids, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		query := &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{
+				Objects: ids,
+				Quiet:   aws.Bool(true),
+			},
+		}
+
+		// remove the batch from the bucket
+		res, err := s3Client.DeleteObjectsWithContext(ctx, query)
+		if err != nil {
+			// the whole batch failed
+			err = WrapError(err, funcTag, fmt.Sprintf("failed to delete batch of %d objects", len(batch)))
+			for _, key := range batch {
+				failed[key] = err
+			}
+			continue
+		}
+
+		// some keys in the batch failed
+		for _, e := range res.Errors {
+			key := aws.StringValue(e.Key)
+			failed[key] = WrapError(fmt.Errorf("%s: %s", aws.StringValue(e.Code), aws.StringValue(e.Message)), funcTag, fmt.Sprintf("failed to delete object: %s", key))
+		}
+
+		contextLogger(ctx).Infof("Deleted batch: %d of %d objects", end, len(keys))
 	}
 
-	return nil
+	return failed
 }
 
-// CopyS3Object copies an object in S3to another bucket and returns an error, if any
-// This operation is the cross-bucket
-func CopyS3Object(s3Client *s3.S3, srcBucket, srcKey, destBucket, destKey, acl string) error {
-	funcTag := "RenameS3Object"
+// S3MaxCopySize is the largest object that s3 copies in a single request
+// larger objects are copied in parts
+var S3MaxCopySize int64 = 5 * 1024 * 1024 * 1024
+
+// S3CopyPartSize is the default size of each part of a copy in parts
+var S3CopyPartSize int64 = 128 * 1024 * 1024
+
+// S3MinPartSize is the smallest part that s3 takes, other than the last one
+var S3MinPartSize int64 = 5 * 1024 * 1024
+
+// s3MaxParts is the most parts a multipart upload can have
+var s3MaxParts int64 = 10000
+
+// s3CopySource gets the url encoded source of a copy
+func s3CopySource(bucket, key string) string {
+	return JoinS3Path(bucket, (&url.URL{Path: key}).EscapedPath())
+}
+
+// CopyS3Object copies an object in S3, possibly to another bucket, and returns an error, if any
+// the copy keeps the content type, headers and metadata of the source, unless the options change them
+// objects over S3MaxCopySize are copied in parts of partSize, concurrency at a time
+func CopyS3Object(ctx context.Context, s3Client *s3.S3, srcBucket, srcKey, destBucket, destKey string, opts CopyOptions, partSize int64, concurrency int) error {
+	funcTag := "CopyS3Object"
 
 	srcFull := JoinS3Path(srcBucket, srcKey)
 	destFull := JoinS3Path(destBucket, destKey)
 
-	// validate the rename
+	// validate the copy
 	if strings.EqualFold(srcFull, destFull) {
-		return WrapError(fmt.Errorf("validation error"), funcTag, "cannot rename object to the same key in the same bucket")
+		return WrapError(fmt.Errorf("validation error"), funcTag, "cannot copy object to the same key in the same bucket")
 	}
 
 	// default the acl
-	if len(acl) == 0 {
-		acl = "private"
+	if len(opts.ACL) == 0 {
+		opts.ACL = "private"
+	}
+
+	// the size picks how to copy, and the headers are kept when anything else changes
+	src, err := HeadS3Object(ctx, s3Client, srcBucket, srcKey)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to get source object: %s", srcFull))
+	}
+	dest := copyS3Headers(src, opts)
+
+	if src.Size > S3MaxCopySize {
+		err = copyS3ObjectInParts(ctx, s3Client, srcBucket, srcKey, destBucket, destKey, opts.ACL, src.Size, dest, partSize, concurrency)
+		if err != nil {
+			return WrapError(err, funcTag, fmt.Sprintf("failed to copy object in parts: %s to %s", srcFull, destFull))
+		}
+		return nil
 	}
 
 	// build the query
+	// headers and metadata are only sent when they change, otherwise s3 copies them
 	query := &s3.CopyObjectInput{
 		Bucket:            aws.String(destBucket),
 		Key:               aws.String(destKey),
-		CopySource:        aws.String(JoinS3Path(srcBucket, srcKey)),
-		MetadataDirective: aws.String("REPLACE"),
-		ACL:               aws.String(acl),
+		CopySource:        aws.String(s3CopySource(srcBucket, srcKey)),
+		MetadataDirective: aws.String(s3.MetadataDirectiveCopy),
+		ACL:               aws.String(opts.ACL),
+		StorageClass:      nonEmptyString(src.StorageClass),
+	}
+	if opts.ChangesSource() {
+		query.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+		query.Metadata = aws.StringMap(dest.Metadata)
+		query.ContentType = nonEmptyString(dest.ContentType)
+		query.ContentDisposition = nonEmptyString(dest.ContentDisposition)
+		query.ContentEncoding = nonEmptyString(dest.ContentEncoding)
+		query.ContentLanguage = nonEmptyString(dest.ContentLanguage)
+		query.CacheControl = nonEmptyString(dest.CacheControl)
 	}
 
 	// copy the original object to a new key
-	_, err := s3Client.CopyObject(query)
+	_, err = s3Client.CopyObjectWithContext(ctx, query)
 	if err != nil {
-		return WrapError(err, funcTag, fmt.Sprintf("failed to delete object with query: %+v", query))
+		return WrapError(err, funcTag, fmt.Sprintf("failed to copy object: %s to %s", srcFull, destFull))
+	}
+
+	return nil
+}
+
+// copyS3Headers gets the headers and metadata of a copy, from the source and the options
+func copyS3Headers(src *S3Object, opts CopyOptions) *S3Object {
+	dest := *src
+	dest.Metadata = map[string]string{}
+	for k, v := range src.Metadata {
+		dest.Metadata[k] = v
+	}
+	for _, k := range opts.DropMetadata {
+		delete(dest.Metadata, strings.ToLower(k))
+	}
+	for k, v := range opts.Metadata {
+		dest.Metadata[strings.ToLower(k)] = v
+	}
+	if len(opts.ContentType) > 0 {
+		dest.ContentType = opts.ContentType
+	}
+	if len(opts.ContentDisposition) > 0 {
+		dest.ContentDisposition = opts.ContentDisposition
+	}
+	if len(opts.CacheControl) > 0 {
+		dest.CacheControl = opts.CacheControl
+	}
+	return &dest
+}
+
+// nonEmptyString gets a pointer to a string, or nil when it is empty, so it is left out of a request
+func nonEmptyString(value string) *string {
+	if len(value) == 0 {
+		return nil
+	}
+	return aws.String(value)
+}
+
+// getS3ObjectTagging gets the tags of an object in AWS S3, url encoded like the tagging header
+func getS3ObjectTagging(ctx context.Context, s3Client *s3.S3, bucket, key string) (string, error) {
+	funcTag := "getS3ObjectTagging"
+
+	// build the query
+	query := &s3.GetObjectTaggingInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+
+	res, err := s3Client.GetObjectTaggingWithContext(ctx, query)
+	if err != nil {
+		return "", WrapError(err, funcTag, fmt.Sprintf("failed to get s3 object tagging with query: %s", QueryString(query)))
+	}
+
+	tags := url.Values{}
+	for _, tag := range res.TagSet {
+		tags.Set(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+	}
+	return tags.Encode(), nil
+}
+
+// copyS3PartSize gets the part size of a copy in parts
+// parts are at least S3MinPartSize, and large enough that there are no more than s3MaxParts of them
+func copyS3PartSize(size, partSize int64) int64 {
+	if partSize <= 0 {
+		partSize = S3CopyPartSize
+	}
+	if partSize < S3MinPartSize {
+		partSize = S3MinPartSize
+	}
+	if minPartSize := (size + s3MaxParts - 1) / s3MaxParts; partSize < minPartSize {
+		partSize = minPartSize
+	}
+	return partSize
+}
+
+// copyS3ObjectInParts copies an object that is too large for a single copy, one byte range per part
+// the storage class and tags are kept, like a single copy keeps them
+// a copy that fails is aborted, so that its parts are not kept (and paid for)
+func copyS3ObjectInParts(ctx context.Context, s3Client *s3.S3, srcBucket, srcKey, destBucket, destKey, acl string, size int64, dest *S3Object, partSize int64, concurrency int) error {
+	funcTag := "copyS3ObjectInParts"
+
+	// there can only be so many parts, and they cannot be too small
+	partSize = copyS3PartSize(size, partSize)
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// a multipart upload does not copy the tags by itself
+	tagging, err := getS3ObjectTagging(ctx, s3Client, srcBucket, srcKey)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to get tags of source object: %s", srcKey))
+	}
+
+	created, err := s3Client.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(destBucket),
+		Key:                aws.String(destKey),
+		ACL:                aws.String(acl),
+		StorageClass:       nonEmptyString(dest.StorageClass),
+		Tagging:            nonEmptyString(tagging),
+		Metadata:           aws.StringMap(dest.Metadata),
+		ContentType:        nonEmptyString(dest.ContentType),
+		ContentDisposition: nonEmptyString(dest.ContentDisposition),
+		ContentEncoding:    nonEmptyString(dest.ContentEncoding),
+		ContentLanguage:    nonEmptyString(dest.ContentLanguage),
+		CacheControl:       nonEmptyString(dest.CacheControl),
+	})
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to start copy in parts: %s", destKey))
+	}
+
+	// copy the parts, a few at a time
+	parts := make([]*s3.CompletedPart, (size+partSize-1)/partSize)
+	eg, egCtx := NewErrGroup(ctx)
+	sem := make(chan struct{}, concurrency)
+	for i := range parts {
+		i := i
+		sem <- struct{}{}
+		if egCtx.Err() != nil {
+			<-sem
+			break
+		}
+		eg.Go(func() error {
+			defer func() { <-sem }()
+
+			first := int64(i) * partSize
+			last := first + partSize - 1
+			if last >= size {
+				last = size - 1
+			}
+			res, err := s3Client.UploadPartCopyWithContext(egCtx, &s3.UploadPartCopyInput{
+				Bucket:          aws.String(destBucket),
+				Key:             aws.String(destKey),
+				UploadId:        created.UploadId,
+				PartNumber:      aws.Int64(int64(i + 1)),
+				CopySource:      aws.String(s3CopySource(srcBucket, srcKey)),
+				CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+			})
+			if err != nil {
+				return WrapError(err, funcTag, fmt.Sprintf("failed to copy part %d of %d: %s", i+1, len(parts), destKey))
+			}
+			parts[i] = &s3.CompletedPart{ETag: res.CopyPartResult.ETag, PartNumber: aws.Int64(int64(i + 1))}
+			return nil
+		})
+	}
+	err = eg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err == nil {
+		_, err = s3Client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(destBucket),
+			Key:             aws.String(destKey),
+			UploadId:        created.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+		if err != nil {
+			err = WrapError(err, funcTag, fmt.Sprintf("failed to finish copy in parts: %s", destKey))
+		}
+	}
+
+	if err != nil {
+		// the command may have been stopped, but the parts should still go
+		_, abortErr := s3Client.AbortMultipartUploadWithContext(context.Background(), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(destBucket),
+			Key:      aws.String(destKey),
+			UploadId: created.UploadId,
+		})
+		if abortErr != nil {
+			contextLogger(ctx).Warnf(WrapError(abortErr, funcTag, fmt.Sprintf("failed to abort copy in parts: %s", destKey)).Error())
+		}
+		return err
 	}
 
 	return nil
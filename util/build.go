@@ -0,0 +1,95 @@
+package util
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// build modes, picked with build tags
+// example: `go build -tags prod`
+var (
+	// BuildModeDev is the default, for working on snapr
+	BuildModeDev = "dev"
+	// BuildModeProd keeps the compiled-in bucket and credentials, and does not log sensitive details
+	BuildModeProd = "prod"
+	// BuildModeRestricted is prod, without the commands that expose the bucket to others
+	BuildModeRestricted = "restricted"
+)
+
+// BuildProfile is what a build mode allows
+type BuildProfile struct {
+	Mode string
+	// AllowOverrides lets flags, env vars and config profiles replace the compiled-in bucket and credentials
+	AllowOverrides bool
+	// DisabledCommands are not registered on the root command
+	DisabledCommands []string
+	LogLevel         logrus.Level
+	// LogQueries lets errors and logs print whole query and options structs, which can hold credentials
+	LogQueries bool
+}
+
+// lockedSettings are the compiled-in settings that only a build with AllowOverrides lets anything replace
+var lockedSettings = map[string]bool{
+	"S3_BUCKET":        true,
+	"S3_TOKEN":         true,
+	"S3_SECRET":        true,
+	"S3_SESSION_TOKEN": true,
+}
+
+// CommandEnabled tells if a command is registered in this build
+func (b BuildProfile) CommandEnabled(name string) bool {
+	for _, disabled := range b.DisabledCommands {
+		if disabled == name {
+			return false
+		}
+	}
+	return true
+}
+
+// SettingLocked tells if a setting was compiled-in, and cannot be replaced in this build
+func SettingLocked(envKey string) bool {
+	if Build.AllowOverrides || !lockedSettings[envKey] {
+		return false
+	}
+	envLayersMutex.RLock()
+	defer envLayersMutex.RUnlock()
+	return len(compiledInEnv[EnvVarName(envKey)]) > 0
+}
+
+// queryFields are the fields of query and options structs that are safe to print in any build
+var queryFields = []string{"Bucket", "Key", "Prefix", "S3Key", "S3SrcKey", "S3DestKey", "S3DestBucket", "InFile", "IsDir"}
+
+// QueryString formats a query or options struct for an error or a log
+// dev builds print the whole struct, and other builds only print the bucket and keys
+func QueryString(query interface{}) string {
+	if Build.LogQueries {
+		return fmt.Sprintf("%+v", query)
+	}
+
+	v := reflect.ValueOf(query)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Sprintf("(%T)", query)
+	}
+
+	var parts []string
+	for _, name := range queryFields {
+		field := v.FieldByName(name)
+		for field.IsValid() && field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		switch {
+		case !field.IsValid():
+		case field.Kind() == reflect.String:
+			parts = append(parts, fmt.Sprintf("%s: %q", name, field.String()))
+		case field.Kind() == reflect.Bool:
+			parts = append(parts, fmt.Sprintf("%s: %t", name, field.Bool()))
+		}
+	}
+	return fmt.Sprintf("%T{%s}", query, strings.Join(parts, ", "))
+}
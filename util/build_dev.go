@@ -0,0 +1,14 @@
+//go:build !prod && !restricted
+// +build !prod,!restricted
+
+package util
+
+import "github.com/sirupsen/logrus"
+
+// Build is the dev build, which allows overrides and debugging
+var Build = BuildProfile{
+	Mode:           BuildModeDev,
+	AllowOverrides: true,
+	LogLevel:       logrus.DebugLevel,
+	LogQueries:     true,
+}
@@ -0,0 +1,12 @@
+//go:build prod && !restricted
+// +build prod,!restricted
+
+package util
+
+import "github.com/sirupsen/logrus"
+
+// Build is the prod build, which keeps the compiled-in bucket and credentials
+var Build = BuildProfile{
+	Mode:     BuildModeProd,
+	LogLevel: logrus.InfoLevel,
+}
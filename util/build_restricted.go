@@ -0,0 +1,13 @@
+//go:build restricted
+// +build restricted
+
+package util
+
+import "github.com/sirupsen/logrus"
+
+// Build is the restricted build, which is prod without the serve command
+var Build = BuildProfile{
+	Mode:             BuildModeRestricted,
+	DisabledCommands: []string{"serve"},
+	LogLevel:         logrus.InfoLevel,
+}
@@ -0,0 +1,227 @@
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// credential sources of a config profile
+var (
+	// ConfigCredentialsKeys uses the token and secret of the profile
+	ConfigCredentialsKeys = "keys"
+	// ConfigCredentialsAWS uses the standard aws credential chain, with the aws profile of the profile if set
+	ConfigCredentialsAWS = "aws"
+)
+
+// Config is a snapr config file, with named profiles
+// example:
+//
+//	profile: photos
+//	profiles:
+//	  photos:
+//	    bucket: my.photos.bucket
+//	    region: us-east-1
+//	    credentials:
+//	      source: aws
+//	      aws_profile: photos
+//	    prefixes:
+//	      upload: uploads
+//	      process: originals
+//	      process_output: processed
+//	      grep: logs
+//	    settings:
+//	      TRASH_DIR: .trash
+type Config struct {
+	// Path is the file that the config was read from
+	Path string `yaml:"-"`
+	// Profile is the profile used when none is selected
+	Profile  string                    `yaml:"profile"`
+	Profiles map[string]*ConfigProfile `yaml:"profiles"`
+}
+
+// ConfigProfile is a named set of settings, like for one bucket
+type ConfigProfile struct {
+	Backend        string            `yaml:"backend"`
+	Bucket         string            `yaml:"bucket"`
+	Region         string            `yaml:"region"`
+	Endpoint       string            `yaml:"endpoint"`
+	ForcePathStyle *bool             `yaml:"force_path_style"`
+	DisableSSL     *bool             `yaml:"disable_ssl"`
+	CABundle       string            `yaml:"ca_bundle"`
+	Credentials    ConfigCredentials `yaml:"credentials"`
+	Prefixes       ConfigPrefixes    `yaml:"prefixes"`
+	// Settings are any other settings, by env var name without the SNAPR_ prefix, like RETRY_ATTEMPTS
+	Settings map[string]string `yaml:"settings"`
+}
+
+// ConfigCredentials is where a profile gets its credentials from
+// without a source, it is "keys" when a token is set, and "aws" when an aws profile is set
+type ConfigCredentials struct {
+	Source       string `yaml:"source"`
+	Token        string `yaml:"token"`
+	Secret       string `yaml:"secret"`
+	SessionToken string `yaml:"session_token"`
+	AWSProfile   string `yaml:"aws_profile"`
+}
+
+// ConfigPrefixes are the default keys of commands that work under a prefix
+type ConfigPrefixes struct {
+	Upload        string `yaml:"upload"`
+	Process       string `yaml:"process"`
+	ProcessOutput string `yaml:"process_output"`
+	Grep          string `yaml:"grep"`
+}
+
+// DefaultConfigPath is where the config file is read from when none is given
+// example: `~/.config/snapr/config.yaml`
+func DefaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "snapr", "config.yaml")
+}
+
+// LoadConfig reads a config file
+func LoadConfig(path string) (*Config, error) {
+	funcTag := "LoadConfig"
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to read config file: %s", path))
+	}
+
+	config := &Config{Path: path}
+	err = yaml.UnmarshalStrict(b, config)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to parse config file: %s", path))
+	}
+
+	for name, profile := range config.Profiles {
+		if profile == nil {
+			config.Profiles[name] = &ConfigProfile{}
+			continue
+		}
+		err = profile.Validate()
+		if err != nil {
+			return nil, WrapError(err, funcTag, fmt.Sprintf("invalid profile '%s' in config file: %s", name, path))
+		}
+
+		// keys in a file that others can read are not secret
+		if len(profile.Credentials.Secret) > 0 {
+			if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+				logrus.Warnf("Config file has credentials and can be read by other users, use `chmod 600 %s`", path)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// ProfileNames gets the names of the profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// credentialsSource gets the credential source, including the one implied by the other fields
+func (p *ConfigProfile) credentialsSource() string {
+	switch {
+	case len(p.Credentials.Source) > 0:
+		return p.Credentials.Source
+	case len(p.Credentials.Token) > 0 || len(p.Credentials.Secret) > 0:
+		return ConfigCredentialsKeys
+	case len(p.Credentials.AWSProfile) > 0:
+		return ConfigCredentialsAWS
+	}
+	return ""
+}
+
+// Validate checks that a profile can be used
+func (p *ConfigProfile) Validate() error {
+	switch p.credentialsSource() {
+	case "", ConfigCredentialsAWS:
+	case ConfigCredentialsKeys:
+		if len(p.Credentials.Token) == 0 || len(p.Credentials.Secret) == 0 {
+			return fmt.Errorf("credentials from keys need both a token and a secret")
+		}
+	default:
+		return fmt.Errorf("unknown credentials source '%s', use one of: [%s,%s]", p.Credentials.Source, ConfigCredentialsKeys, ConfigCredentialsAWS)
+	}
+	for envKey := range p.Settings {
+		if len(envKey) == 0 || strings.HasPrefix(strings.ToUpper(envKey), envPrefix+"_") {
+			return fmt.Errorf("settings are named without the %s_ prefix: '%s'", envPrefix, envKey)
+		}
+	}
+	return nil
+}
+
+// Env gets the settings of a profile by env key without the prefix, for SetProfileEnv
+func (p *ConfigProfile) Env() map[string]string {
+	env := map[string]string{}
+
+	// any other settings go first, so that the named ones win
+	for envKey, value := range p.Settings {
+		env[strings.ToUpper(envKey)] = value
+	}
+
+	set := func(envKey, value string) {
+		if len(value) > 0 {
+			env[envKey] = value
+		}
+	}
+	set("BACKEND", p.Backend)
+	set("S3_BUCKET", p.Bucket)
+	set("S3_REGION", p.Region)
+	set("S3_ENDPOINT", p.Endpoint)
+	set("S3_CA_BUNDLE", p.CABundle)
+	if p.ForcePathStyle != nil {
+		env["S3_FORCE_PATH_STYLE"] = BoolToEnvString(*p.ForcePathStyle)
+	}
+	if p.DisableSSL != nil {
+		env["S3_DISABLE_SSL"] = BoolToEnvString(*p.DisableSSL)
+	}
+
+	// the credentials of a profile replace the compiled-in ones, even when empty
+	switch p.credentialsSource() {
+	case ConfigCredentialsKeys:
+		env["S3_TOKEN"] = p.Credentials.Token
+		env["S3_SECRET"] = p.Credentials.Secret
+		env["S3_SESSION_TOKEN"] = p.Credentials.SessionToken
+	case ConfigCredentialsAWS:
+		env["S3_TOKEN"] = ""
+		env["S3_SECRET"] = ""
+		env["S3_SESSION_TOKEN"] = ""
+		env["AWS_PROFILE"] = p.Credentials.AWSProfile
+	}
+
+	set("UPLOAD_S3_DIR", p.Prefixes.Upload)
+	set("PROCESS_S3_SRC_KEY", p.Prefixes.Process)
+	set("PROCESS_S3_DEST_KEY", p.Prefixes.ProcessOutput)
+	set("GREP_S3_DIR", p.Prefixes.Grep)
+
+	return env
+}
+
+// RedactSecret hides a secret for display, like a token or secret key
+// long values keep their last 4 characters, so they can still be told apart
+func RedactSecret(value string) string {
+	switch {
+	case len(value) == 0:
+		return ""
+	case len(value) < 12:
+		return "****"
+	}
+	return strings.Repeat("*", 16) + value[len(value)-4:]
+}
@@ -5,16 +5,91 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
 var envPrefix = "SNAPR"
 
+// where a setting came from, other than a flag or its default
+var (
+	EnvSourceEnv        = "env"
+	EnvSourceProfile    = "profile"
+	EnvSourceCompiledIn = "compiled-in"
+)
+
+// settings under the env, from the compiled-in .env and the selected config profile
+var (
+	envLayersMutex sync.RWMutex
+	compiledInEnv  = map[string]string{}
+	profileEnv     = map[string]string{}
+)
+
+// EnvVarName gets the full env var name for an env key, like SNAPR_S3_BUCKET
+func EnvVarName(envKey string) string {
+	return fmt.Sprintf("%s_%s", envPrefix, envKey)
+}
+
+// IsEnvVarName tells if a full env var name is a snapr setting
+func IsEnvVarName(name string) bool {
+	return strings.HasPrefix(name, envPrefix+"_")
+}
+
+// SetCompiledInEnv sets the settings of the compiled-in .env, by full env var name
+// they go after the env and the config profile
+func SetCompiledInEnv(values map[string]string) {
+	envLayersMutex.Lock()
+	defer envLayersMutex.Unlock()
+	compiledInEnv = map[string]string{}
+	for name, value := range values {
+		compiledInEnv[name] = value
+	}
+}
+
+// SetProfileEnv sets the settings of the selected config profile, by env key without the prefix
+// an empty value unsets a compiled-in setting
+func SetProfileEnv(values map[string]string) {
+	envLayersMutex.Lock()
+	defer envLayersMutex.Unlock()
+	profileEnv = map[string]string{}
+	for envKey, value := range values {
+		profileEnv[envKey] = value
+	}
+}
+
+// LookupEnvVar gets the raw value of a setting and where it came from
+// the env comes first, then the config profile, then the compiled-in .env,
+// except for the locked settings of a build that does not allow overrides
+// the source is empty when it is not set anywhere
+func LookupEnvVar(envKey string) (string, string) {
+	envLayersMutex.RLock()
+	defer envLayersMutex.RUnlock()
+
+	name := EnvVarName(envKey)
+	compiled := compiledInEnv[name]
+	if len(compiled) > 0 && !Build.AllowOverrides && lockedSettings[envKey] {
+		return compiled, EnvSourceCompiledIn
+	}
+	if value := os.Getenv(name); len(value) > 0 {
+		return value, EnvSourceEnv
+	}
+	if profileValue, ok := profileEnv[envKey]; ok {
+		if len(profileValue) == 0 {
+			return "", ""
+		}
+		return profileValue, EnvSourceProfile
+	}
+	if len(compiled) > 0 {
+		return compiled, EnvSourceCompiledIn
+	}
+	return "", ""
+}
+
 // osGetEnvRawValPrefixed gets the env var string value for a prefixed env var
 func osGetEnvRawValPrefixed(envKey string) string {
-	key := fmt.Sprintf("%s_%s", envPrefix, envKey)
-	return os.Getenv(key)
+	value, _ := LookupEnvVar(envKey)
+	return value
 }
 
 // EnvVarString returns the string input or the default if not set
@@ -149,3 +224,36 @@ func EnvVarBool(envKey string, defaultValue bool) bool {
 	stringValue := EnvVarString(envKey, stringDefault)
 	return EnvStringToBool(stringValue, defaultValue)
 }
+
+// EnvVarFloat returns the input as a float, or the default if not set
+func EnvVarFloat(envKey string, defaultValue float64) float64 {
+	strValue := osGetEnvRawValPrefixed(envKey)
+	if len(strValue) == 0 {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(strValue, 64)
+	if err != nil {
+		logrus.Warnf(err.Error())
+		return 0
+	}
+	return floatValue
+}
+
+// EnvVarStringMap returns a map of a `key=value,key=value` env variable, or its default
+func EnvVarStringMap(envKey string, defaultValue map[string]string) map[string]string {
+	strValue := osGetEnvRawValPrefixed(envKey)
+	if len(strValue) == 0 {
+		return defaultValue
+	}
+
+	result := map[string]string{}
+	for _, pair := range strings.Split(strValue, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(strings.TrimSpace(kv[0])) == 0 {
+			logrus.Warnf("Found unparsable input in map: %s", strValue)
+			continue
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result
+}
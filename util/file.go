@@ -1,12 +1,14 @@
 package util
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
-
-	"github.com/sirupsen/logrus"
 )
 
 type WalkedFile struct {
@@ -24,7 +26,6 @@ func WalkFiles(walkDir string) (files []*WalkedFile, err error) {
 	err = filepath.Walk(walkDir, WalkAllFilesHelper(&files))
 	if err != nil {
 		err = WrapError(err, funcTag, fmt.Sprintf("walking files in %s", walkDir))
-		logrus.Warnf("walking helper error: %s", err)
 		return
 	}
 	return
@@ -80,3 +81,63 @@ func WriteFileBytes(absFilePath string, byteSlice []byte) error {
 
 	return nil
 }
+
+// WriteFileAtomic writes a new file through a temp file in the same directory
+// the file only shows up at its path once the write is complete
+func WriteFileAtomic(absFilePath string, write func(file *os.File) error) error {
+	funcTag := "WriteFileAtomic"
+
+	// ensure dir exists
+	mkdir := filepath.Dir(absFilePath)
+	err := os.MkdirAll(mkdir, 0700)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("falied to mkdir: %s", mkdir))
+	}
+
+	// temp file next to the target, so the rename stays on the same filesystem
+	tmpFile, err := ioutil.TempFile(mkdir, "."+filepath.Base(absFilePath)+".*.tmp")
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to create temp file for: %s", absFilePath))
+	}
+	tmpPath := tmpFile.Name()
+
+	// write, and clean up the temp file if anything goes wrong
+	err = write(tmpFile)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// temp files are created as 0600, match os.Create (less the usual umask)
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, absFilePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return WrapError(err, funcTag, fmt.Sprintf("failed to write file: %s", absFilePath))
+	}
+
+	return nil
+}
+
+// FileMD5 gets the hex md5 checksum of a file
+// for objects that were not uploaded in parts, this is the same as the s3 etag
+func FileMD5(absFilePath string) (string, error) {
+	funcTag := "FileMD5"
+
+	file, err := os.Open(absFilePath)
+	if err != nil {
+		return "", WrapError(err, funcTag, fmt.Sprintf("failed to open file: %s", absFilePath))
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", WrapError(err, funcTag, fmt.Sprintf("failed to read file: %s", absFilePath))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,337 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FSBucketScheme is the bucket prefix that selects the local filesystem backend
+// example: `--s3-bucket=file:///srv/photos`
+var FSBucketScheme = "file://"
+
+// FSStorage is the local filesystem storage backend
+// buckets are directories, and keys are paths inside of them
+// there are no requests to limit, but reads and writes of file contents share the bandwidth limit
+type FSStorage struct {
+	Bytes *RateLimiter
+}
+
+// FSBucketPath gets the directory for a bucket, with or without the `file://` scheme
+func FSBucketPath(bucket string) string {
+	return strings.TrimPrefix(bucket, FSBucketScheme)
+}
+
+// fsObjectPath gets the path of a key inside of a bucket directory
+// and makes sure that the key does not point outside of it
+func fsObjectPath(bucket, key string) (string, error) {
+	funcTag := "fsObjectPath"
+
+	// the bucket must be a dir
+	root := FSBucketPath(bucket)
+	if len(root) == 0 {
+		return "", WrapError(fmt.Errorf("validation error"), funcTag, "bucket directory cannot be empty")
+	}
+	root = filepath.Clean(root)
+
+	// keys always use the s3 delimiter
+	path := filepath.Join(root, filepath.FromSlash(key))
+	if path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("key is outside of the bucket directory: %s", key))
+	}
+
+	return path, nil
+}
+
+// List gets the files and directories under a key
+// with the delimiter, this behaves like the delimiter mode of `ListS3ObjectsByKey`
+func (s *FSStorage) List(ctx context.Context, bucket, key string, useDelimiter bool) ([]*S3Object, []*S3Directory, error) {
+	funcTag := "FSStorage.List"
+
+	root, err := fsObjectPath(bucket, "")
+	if err != nil {
+		return nil, nil, WrapError(err, funcTag, "failed to get bucket directory")
+	}
+
+	// keys are prefixes, so start walking from the deepest directory in the key
+	walkDir := root
+	if idx := strings.LastIndex(key, S3Delimiter); idx >= 0 {
+		walkDir, err = fsObjectPath(bucket, key[:idx])
+		if err != nil {
+			return nil, nil, WrapError(err, funcTag, "failed to get directory for key")
+		}
+	}
+
+	log := contextLogger(ctx)
+	log.Infof("Fetching from: %s::%s", root, key)
+
+	var files []*S3Object
+	var folders []*S3Directory
+
+	// nothing under this key
+	if _, err := os.Stat(walkDir); os.IsNotExist(err) {
+		log.Infof("Done fetching. 0 files")
+		return files, folders, nil
+	}
+
+	err = filepath.Walk(walkDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return WrapError(err, funcTag, "walking helper error")
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// the key for this path, relative to the bucket
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return WrapError(err, funcTag, fmt.Sprintf("failed to get key for path: %s", path))
+		}
+		objKey := filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if path == walkDir {
+				return nil
+			}
+			dirKey := EnsureS3DirPath(objKey)
+			// skip directories that cannot contain a match
+			if !strings.HasPrefix(dirKey, key) && !strings.HasPrefix(key, dirKey) {
+				return filepath.SkipDir
+			}
+			// with the delimiter, directories are common keys, and we do not go into them
+			if useDelimiter && strings.HasPrefix(dirKey, key) {
+				folders = append(folders, &S3Directory{Key: dirKey})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// filter out ".DS_Store" files
+		if strings.EqualFold(info.Name(), ".ds_store") {
+			return nil
+		}
+
+		if strings.HasPrefix(objKey, key) {
+			files = append(files, &S3Object{
+				Key:          objKey,
+				Extension:    strings.ReplaceAll(filepath.Ext(objKey), ".", ""),
+				Size:         info.Size(),
+				LastModified: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return files, folders, WrapError(err, funcTag, fmt.Sprintf("failed to walk bucket directory: %s", walkDir))
+	}
+
+	// s3 lists keys in order
+	sort.SliceStable(files, func(a, b int) bool { return files[a].Key < files[b].Key })
+	sort.SliceStable(folders, func(a, b int) bool { return folders[a].Key < folders[b].Key })
+
+	msg := fmt.Sprintf("Done fetching. %d files", len(files))
+	if useDelimiter {
+		msg = fmt.Sprintf("%s, %d folders", msg, len(folders))
+	}
+	log.Infof(msg)
+
+	return files, folders, nil
+}
+
+// Head gets the details of a file
+// files have no metadata, so it is always empty
+func (s *FSStorage) Head(ctx context.Context, bucket, key string) (*S3Object, error) {
+	funcTag := "FSStorage.Head"
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	path, err := fsObjectPath(bucket, key)
+	if err != nil {
+		return nil, WrapError(err, funcTag, "failed to get path for key")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to stat file: %s", path))
+	}
+	if info.IsDir() {
+		return nil, WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("key is a directory: %s", key))
+	}
+
+	return &S3Object{
+		Key:          key,
+		Extension:    strings.ReplaceAll(filepath.Ext(key), ".", ""),
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		Metadata:     map[string]string{},
+	}, nil
+}
+
+// ACL is always empty, since files have no acls
+func (s *FSStorage) ACL(ctx context.Context, bucket, key string) (string, error) {
+	return "", ctx.Err()
+}
+
+// Get reads a single file into memory
+func (s *FSStorage) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	funcTag := "FSStorage.Get"
+
+	path, err := fsObjectPath(bucket, key)
+	if err != nil {
+		return []byte{}, WrapError(err, funcTag, "failed to get path for key")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return []byte{}, WrapError(err, funcTag, fmt.Sprintf("failed to open file: %s", path))
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(limitReader(ctx, &contextReader{ctx: ctx, r: file}, s.Bytes))
+	if err != nil {
+		return []byte{}, WrapError(err, funcTag, fmt.Sprintf("failed to read file: %s", path))
+	}
+
+	return b, nil
+}
+
+// Download streams a single file to another file
+func (s *FSStorage) Download(ctx context.Context, bucket, key, absFilePath string) error {
+	funcTag := "FSStorage.Download"
+
+	path, err := fsObjectPath(bucket, key)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to get path for key")
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to open file: %s", path))
+	}
+	defer src.Close()
+
+	return WriteFileAtomic(absFilePath, func(file *os.File) error {
+		_, err := io.Copy(file, limitReader(ctx, &contextReader{ctx: ctx, r: src}, s.Bytes))
+		return err
+	})
+}
+
+// Put streams a single file
+// acl does not apply to the local filesystem
+func (s *FSStorage) Put(ctx context.Context, bucket, acl, key string, body io.Reader) error {
+	funcTag := "FSStorage.Put"
+
+	path, err := fsObjectPath(bucket, key)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to get path for key")
+	}
+
+	return WriteFileAtomic(path, func(file *os.File) error {
+		_, err := io.Copy(file, limitReader(ctx, &contextReader{ctx: ctx, r: body}, s.Bytes))
+		return err
+	})
+}
+
+// Copy copies a file to another key, possibly in another bucket directory
+// the acl, headers and metadata in the options do not apply to the local filesystem
+func (s *FSStorage) Copy(ctx context.Context, srcBucket, srcKey, destBucket, destKey string, opts CopyOptions) error {
+	funcTag := "FSStorage.Copy"
+
+	srcPath, err := fsObjectPath(srcBucket, srcKey)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to get path for source key")
+	}
+	destPath, err := fsObjectPath(destBucket, destKey)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to get path for destination key")
+	}
+
+	// validate the copy
+	if srcPath == destPath {
+		return WrapError(fmt.Errorf("validation error"), funcTag, "cannot copy file to the same key in the same bucket")
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to open file: %s", srcPath))
+	}
+	defer src.Close()
+
+	// a cancelled copy does not leave a partial file behind
+	err = WriteFileAtomic(destPath, func(file *os.File) error {
+		_, err := io.Copy(file, limitReader(ctx, &contextReader{ctx: ctx, r: src}, s.Bytes))
+		return err
+	})
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to copy file: %s", destPath))
+	}
+
+	return nil
+}
+
+// Delete removes a file, and any directories left empty by it
+// like s3, deleting a key that does not exist is not an error
+func (s *FSStorage) Delete(ctx context.Context, bucket, key string) error {
+	funcTag := "FSStorage.Delete"
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	root, err := fsObjectPath(bucket, "")
+	if err != nil {
+		return WrapError(err, funcTag, "failed to get bucket directory")
+	}
+	path, err := fsObjectPath(bucket, key)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to get path for key")
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to remove file: %s", path))
+	}
+
+	// s3 has no empty directories, so clean them up
+	// removing a directory that is not empty fails, which ends the loop
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// DeleteMany removes many files, one at a time
+func (s *FSStorage) DeleteMany(ctx context.Context, bucket string, keys []string) map[string]error {
+	failed := map[string]error{}
+	for _, key := range keys {
+		if err := s.Delete(ctx, bucket, key); err != nil {
+			failed[key] = err
+		}
+	}
+	return failed
+}
+
+// contextReader stops a copy once its context is done
+// local file reads cannot be interrupted, so this is checked between them
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader, unless the context is done
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
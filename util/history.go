@@ -0,0 +1,220 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// history operations
+var (
+	HistoryRename = "rename"
+	HistoryCopy   = "copy"
+	HistoryDelete = "delete"
+)
+
+// historyExt is the extension of history entry files and objects
+var historyExt = ".json"
+
+// HistoryMove is an object that an operation moved or copied from one key to another
+type HistoryMove struct {
+	SrcBucket  string `json:"src_bucket"`
+	SrcKey     string `json:"src_key"`
+	DestBucket string `json:"dest_bucket"`
+	DestKey    string `json:"dest_key"`
+	Size       int64  `json:"size,omitempty"`
+	// Copy is set when the source was left in place
+	Copy bool `json:"copy,omitempty"`
+	// Undone is set once the move was reversed
+	Undone bool `json:"undone,omitempty"`
+}
+
+// HistoryEntry is a rename, copy or delete, with every object that it moved
+// deletes record the move of each object into the trash
+type HistoryEntry struct {
+	ID        string         `json:"id"`
+	Operation string         `json:"operation"`
+	Bucket    string         `json:"bucket"`
+	Key       string         `json:"key"`
+	User      string         `json:"user"`
+	Time      time.Time      `json:"time"`
+	Moves     []*HistoryMove `json:"moves"`
+	UndoneAt  *time.Time     `json:"undone_at,omitempty"`
+}
+
+// NewHistoryEntry starts an entry for an operation, with an id that sorts by time
+// example: `2006-01-02T15-04-05-rename-1a2b3c`
+func NewHistoryEntry(operation, bucket, key string, moves []*HistoryMove) *HistoryEntry {
+	now := time.Now()
+
+	// the time alone is not unique, for operations started together
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+
+	return &HistoryEntry{
+		ID:        fmt.Sprintf("%s-%s-%s", now.UTC().Format(secondTimeFormat), operation, hex.EncodeToString(suffix)),
+		Operation: operation,
+		Bucket:    bucket,
+		Key:       key,
+		User:      CurrentUser(),
+		Time:      now,
+		Moves:     moves,
+	}
+}
+
+// History keeps operation entries in a local directory, and optionally under a key prefix in the bucket
+// so that they can be listed and undone later, from this machine or another one
+type History struct {
+	// Dir is the local directory, and may be empty
+	Dir string
+	// Prefix is the key prefix in the bucket, and may be empty
+	Prefix  string
+	Storage Storage
+	Bucket  string
+}
+
+// validHistoryID makes sure an id cannot point outside of the history
+func validHistoryID(id string) error {
+	if len(id) == 0 || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return fmt.Errorf("invalid history id: '%s'", id)
+	}
+	return nil
+}
+
+// Save writes an entry everywhere that history is kept
+func (h *History) Save(ctx context.Context, entry *HistoryEntry) error {
+	funcTag := "History.Save"
+
+	err := validHistoryID(entry.ID)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to validate entry")
+	}
+
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return WrapError(err, funcTag, "failed to encode entry")
+	}
+
+	if len(h.Dir) > 0 {
+		path := filepath.Join(h.Dir, entry.ID+historyExt)
+		err = WriteFileAtomic(path, func(file *os.File) error {
+			_, err := file.Write(b)
+			return err
+		})
+		if err != nil {
+			return WrapError(err, funcTag, fmt.Sprintf("failed to write entry: %s", path))
+		}
+	}
+
+	if len(h.Prefix) > 0 {
+		key := JoinS3Path(h.Prefix, entry.ID+historyExt)
+		err = h.Storage.Put(ctx, h.Bucket, "private", key, bytes.NewReader(b))
+		if err != nil {
+			return WrapError(err, funcTag, fmt.Sprintf("failed to put entry: %s", key))
+		}
+	}
+
+	return nil
+}
+
+// Load reads an entry, from the local directory first, and then from the bucket
+func (h *History) Load(ctx context.Context, id string) (*HistoryEntry, error) {
+	funcTag := "History.Load"
+
+	err := validHistoryID(id)
+	if err != nil {
+		return nil, WrapError(err, funcTag, "failed to validate id")
+	}
+
+	var b []byte
+	if len(h.Dir) > 0 {
+		b, err = ioutil.ReadFile(filepath.Join(h.Dir, id+historyExt))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, WrapError(err, funcTag, fmt.Sprintf("failed to read entry: %s", id))
+		}
+	}
+	if len(b) == 0 && len(h.Prefix) > 0 {
+		b, err = h.Storage.Get(ctx, h.Bucket, JoinS3Path(h.Prefix, id+historyExt))
+		if err != nil {
+			return nil, WrapError(err, funcTag, fmt.Sprintf("failed to get entry: %s", id))
+		}
+	}
+	if len(b) == 0 {
+		return nil, WrapError(fmt.Errorf("not found"), funcTag, fmt.Sprintf("no history entry: %s", id))
+	}
+
+	var entry HistoryEntry
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to decode entry: %s", id))
+	}
+
+	return &entry, nil
+}
+
+// List gets the most recent entries for the bucket, newest first
+// entries from the local directory and the bucket are merged by id
+func (h *History) List(ctx context.Context, limit int) ([]*HistoryEntry, error) {
+	funcTag := "History.List"
+
+	ids := map[string]bool{}
+
+	if len(h.Dir) > 0 {
+		files, err := ioutil.ReadDir(h.Dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, WrapError(err, funcTag, fmt.Sprintf("failed to read history dir: %s", h.Dir))
+		}
+		for _, file := range files {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), historyExt) {
+				ids[strings.TrimSuffix(file.Name(), historyExt)] = true
+			}
+		}
+	}
+
+	if len(h.Prefix) > 0 {
+		prefix := EnsureS3DirPath(h.Prefix)
+		objects, _, err := h.Storage.List(ctx, h.Bucket, prefix, true)
+		if err != nil {
+			return nil, WrapError(err, funcTag, fmt.Sprintf("failed to list history: %s", prefix))
+		}
+		for _, object := range objects {
+			if strings.HasSuffix(object.Key, historyExt) {
+				ids[strings.TrimSuffix(strings.TrimPrefix(object.Key, prefix), historyExt)] = true
+			}
+		}
+	}
+
+	// ids start with the time, so they sort by it
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	// the local directory is shared by every bucket
+	entries := []*HistoryEntry{}
+	for _, id := range sorted {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		entry, err := h.Load(ctx, id)
+		if err != nil {
+			return nil, WrapError(err, funcTag, "failed to load entry")
+		}
+		if entry.Bucket != h.Bucket {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,254 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// journal record types
+var (
+	JournalStart = "start"
+	JournalPlan  = "plan"
+	JournalDone  = "done"
+)
+
+// JournalRecord is a single line of a journal file
+type JournalRecord struct {
+	Type      string          `json:"type"`
+	Time      time.Time       `json:"time"`
+	Operation string          `json:"operation,omitempty"`
+	Bucket    string          `json:"bucket,omitempty"`
+	Options   json.RawMessage `json:"options,omitempty"`
+	Key       string          `json:"key,omitempty"`
+	Size      int64           `json:"size,omitempty"`
+}
+
+// Journal records the keys that a directory operation planned, and the ones that it finished
+// so that a run that crashed or was stopped can be resumed where it left off
+// records are appended one json line at a time, as they happen
+// a nil journal records nothing, so callers do not need to check for one
+type Journal struct {
+	Path      string
+	Operation string
+	Bucket    string
+	Options   json.RawMessage
+	// Started is when the first run started
+	Started time.Time
+
+	planned []*S3Object
+	done    map[string]bool
+	file    *os.File
+	mutex   sync.Mutex
+}
+
+// NewJournal starts a new journal file in a directory
+// the options are saved, so that a resumed run does the same thing
+func NewJournal(dir, operation, bucket string, options interface{}) (*Journal, error) {
+	funcTag := "NewJournal"
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to mkdir: %s", dir))
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return nil, WrapError(err, funcTag, "failed to encode options")
+	}
+
+	started := time.Now()
+	file, err := ioutil.TempFile(dir, fmt.Sprintf("%s-%s-*.journal", operation, started.UTC().Format(secondTimeFormat)))
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to create journal in: %s", dir))
+	}
+
+	j := &Journal{
+		Path:      file.Name(),
+		Operation: operation,
+		Bucket:    bucket,
+		Options:   b,
+		Started:   started,
+		done:      map[string]bool{},
+		file:      file,
+	}
+
+	err = j.write(&JournalRecord{Type: JournalStart, Time: started, Operation: operation, Bucket: bucket, Options: b})
+	if err != nil {
+		file.Close()
+		return nil, WrapError(err, funcTag, "failed to start journal")
+	}
+
+	return j, nil
+}
+
+// OpenJournal opens a journal to resume it
+// it must be for the same operation, and new records are appended to it
+func OpenJournal(path, operation string) (*Journal, error) {
+	funcTag := "OpenJournal"
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to open journal: %s", path))
+	}
+
+	j := &Journal{
+		Path: path,
+		done: map[string]bool{},
+		file: file,
+	}
+
+	// replay the records
+	// a crash can leave the last line cut short, so only complete lines count
+	scanr := bufio.NewScanner(file)
+	scanr.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for line := 1; scanr.Scan(); line++ {
+		var record JournalRecord
+		if json.Unmarshal(scanr.Bytes(), &record) != nil {
+			continue
+		}
+
+		switch record.Type {
+		case JournalStart:
+			if line == 1 {
+				j.Operation = record.Operation
+				j.Bucket = record.Bucket
+				j.Options = record.Options
+				j.Started = record.Time
+			}
+		case JournalPlan:
+			j.planned = append(j.planned, &S3Object{
+				Key:       record.Key,
+				Extension: strings.ReplaceAll(filepath.Ext(record.Key), ".", ""),
+				Size:      record.Size,
+			})
+		case JournalDone:
+			j.done[record.Key] = true
+		}
+	}
+	if err := scanr.Err(); err != nil {
+		file.Close()
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to read journal: %s", path))
+	}
+
+	if j.Operation != operation {
+		file.Close()
+		return nil, WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("journal is for '%s', not '%s': %s", j.Operation, operation, path))
+	}
+
+	return j, nil
+}
+
+// write appends a record as a single line
+func (j *Journal) write(record *JournalRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = j.file.Write(append(b, '\n'))
+	return err
+}
+
+// HasPlan tells if the keys to operate on were already planned, by an earlier run
+func (j *Journal) HasPlan() bool {
+	if j == nil {
+		return false
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.planned) > 0
+}
+
+// Plan records the objects to operate on, and gets the ones that are not done yet
+// once planned, the plan does not change, and the objects passed in on resume are ignored
+func (j *Journal) Plan(objects []*S3Object) ([]*S3Object, error) {
+	funcTag := "Journal.Plan"
+
+	if j == nil {
+		return objects, nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if len(j.planned) == 0 {
+		for _, object := range objects {
+			err := j.write(&JournalRecord{Type: JournalPlan, Time: time.Now(), Key: object.Key, Size: object.Size})
+			if err != nil {
+				return nil, WrapError(err, funcTag, fmt.Sprintf("failed to write to journal: %s", j.Path))
+			}
+		}
+		j.planned = objects
+	}
+
+	var remaining []*S3Object
+	for _, object := range j.planned {
+		if !j.done[object.Key] {
+			remaining = append(remaining, object)
+		}
+	}
+	return remaining, nil
+}
+
+// Progress gets how many of the planned keys are done
+func (j *Journal) Progress() (int, int) {
+	if j == nil {
+		return 0, 0
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return len(j.done), len(j.planned)
+}
+
+// Done records a key that is finished, so that a resumed run does not do it again
+func (j *Journal) Done(key string) error {
+	funcTag := "Journal.Done"
+
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	err := j.write(&JournalRecord{Type: JournalDone, Time: time.Now(), Key: key})
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to write to journal: %s", j.Path))
+	}
+	j.done[key] = true
+
+	return nil
+}
+
+// Close closes the journal file
+// when the operation finished everything, the journal is removed, since there is nothing left to resume
+func (j *Journal) Close(finished bool) error {
+	funcTag := "Journal.Close"
+
+	if j == nil {
+		return nil
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	err := j.file.Close()
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to close journal: %s", j.Path))
+	}
+
+	if finished {
+		err = os.Remove(j.Path)
+		if err != nil {
+			return WrapError(err, funcTag, fmt.Sprintf("failed to remove finished journal: %s", j.Path))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RateLimiter spreads out units of work, like requests or bytes, to a maximum rate per second
+// it is shared by every worker, and lets up to a second of work through at once
+// a nil limiter does not limit anything
+type RateLimiter struct {
+	interval time.Duration
+	burst    time.Duration
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// NewRateLimiter gets a limiter for a rate per second, or nil for no limit
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		burst:    time.Second,
+	}
+}
+
+// Wait blocks until n units can go, or the context is done
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	// reserve the time for n units after the ones that are already taken
+	// unused time, up to the burst, can be spent at once
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now.Add(-l.burst)) {
+		l.next = now.Add(-l.burst)
+	}
+	l.next = l.next.Add(time.Duration(n) * l.interval)
+	wait := l.next.Sub(now)
+	l.mutex.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedReader reads no faster than its limiter allows
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+// limitedReadSize keeps each read small, so that the rate stays even
+var limitedReadSize = 32 * 1024
+
+// Read reads from the underlying reader, then waits for the bytes that were read
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitedReadSize {
+		p = p[:limitedReadSize]
+	}
+	n, err := lr.r.Read(p)
+	if waitErr := lr.limiter.Wait(lr.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
+
+// limitedWriterAt writes no faster than its limiter allows
+// downloads in parts write each part as it arrives, so the parts of every worker share the limit
+type limitedWriterAt struct {
+	ctx     context.Context
+	w       io.WriterAt
+	limiter *RateLimiter
+}
+
+// WriteAt waits for the bytes, then writes them to the underlying writer
+// the body is not read while this waits, so the transfer slows down with it
+func (lw *limitedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := lw.limiter.Wait(lw.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return lw.w.WriteAt(p, off)
+}
+
+// limitReader gets a reader that is no faster than the limiter, or the reader itself when there is no limit
+func limitReader(ctx context.Context, r io.Reader, limiter *RateLimiter) io.Reader {
+	if limiter == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, r: r, limiter: limiter}
+}
+
+// limitWriterAt gets a writer that is no faster than the limiter, or the writer itself when there is no limit
+func limitWriterAt(ctx context.Context, w io.WriterAt, limiter *RateLimiter) io.WriterAt {
+	if limiter == nil {
+		return w
+	}
+	return &limitedWriterAt{ctx: ctx, w: w, limiter: limiter}
+}
+
+// rateLimitHandler waits for the request limiter before every request is sent
+// it is a send handler, so each page of a listing, each part of a multipart transfer, each batch of a delete and each retry counts
+func rateLimitHandler(limiter *RateLimiter) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "snapr.RateLimitHandler",
+		Fn: func(req *request.Request) {
+			if err := limiter.Wait(req.Context(), 1); err != nil {
+				req.Error = awserr.New(request.CanceledErrorCode, "stopped waiting for rate limit", err)
+			}
+		},
+	}
+}
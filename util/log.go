@@ -0,0 +1,32 @@
+package util
+
+import (
+	"context"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+// loggerContextKey is where a logger is kept in a context
+type loggerContextKey struct{}
+
+// discardLogger is the logger of a context without one
+var discardLogger = func() logrus.FieldLogger {
+	log := logrus.New()
+	log.SetOutput(ioutil.Discard)
+	return log
+}()
+
+// WithLogger keeps a logger in a context, so that the storage backends and retries made for it log to it
+// only the env and config parsing, which runs before there is a context, warns on the global logger
+func WithLogger(ctx context.Context, log logrus.FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, log)
+}
+
+// contextLogger gets the logger of a context, which discards everything when there is none
+func contextLogger(ctx context.Context) logrus.FieldLogger {
+	if log, ok := ctx.Value(loggerContextKey{}).(logrus.FieldLogger); ok && log != nil {
+		return log
+	}
+	return discardLogger
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OperationReport tracks what a command did to each key
+// it is safe to use from many goroutines, and its fields should only be read after the command returns
+type OperationReport struct {
+	Operation string              `json:"operation"`
+	Succeeded []string            `json:"succeeded"`
+	Skipped   []string            `json:"skipped"`
+	Failed    []*OperationFailure `json:"failed"`
+	Bytes     int64               `json:"bytes"`
+	Retries   int                 `json:"retries"`
+	Duration  time.Duration       `json:"duration"`
+
+	// what each command did, for machine readable output
+	// like uploaded keys, downloaded paths or grep matches
+	Results []interface{} `json:"results,omitempty"`
+
+	mutex   sync.Mutex
+	started time.Time
+
+	// why the operation stopped before starting every key, if it did
+	stopped    error
+	notStarted int
+}
+
+// OperationFailure is a key that failed, and why
+type OperationFailure struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// NewOperationReport starts a report for an operation, like "upload"
+func NewOperationReport(operation string) *OperationReport {
+	return &OperationReport{
+		Operation: operation,
+		Succeeded: []string{},
+		Skipped:   []string{},
+		Failed:    []*OperationFailure{},
+		started:   time.Now(),
+	}
+}
+
+// Succeed records a key that was operated on, and the bytes that were moved for it, if any
+func (r *OperationReport) Succeed(key string, bytes int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Succeeded = append(r.Succeeded, key)
+	r.Bytes += bytes
+}
+
+// AddResult records the details of something the command did
+func (r *OperationReport) AddResult(result interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Results = append(r.Results, result)
+}
+
+// Skip records a key that did not need an operation
+func (r *OperationReport) Skip(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Skipped = append(r.Skipped, key)
+}
+
+// Retry counts a request that was tried again
+func (r *OperationReport) Retry() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Retries++
+}
+
+// Fail records a key that failed
+func (r *OperationReport) Fail(key string, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Failed = append(r.Failed, &OperationFailure{Key: key, Error: err.Error()})
+}
+
+// Cancelled tells if the context is done, and records the key as skipped if so
+// workers check this before starting on a key, so that work in flight drains and nothing new starts
+func (r *OperationReport) Cancelled(ctx context.Context, key string) bool {
+	err := ctx.Err()
+	if err == nil {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.Skipped = append(r.Skipped, key)
+	r.stopped = err
+	r.notStarted++
+	return true
+}
+
+// Finish stops the clock and sorts the keys
+// it returns an error when any key failed, or when keys were not started because the operation was cancelled
+func (r *OperationReport) Finish() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.Duration = time.Since(r.started)
+	sort.Strings(r.Succeeded)
+	sort.Strings(r.Skipped)
+	sort.SliceStable(r.Failed, func(a, b int) bool { return r.Failed[a].Key < r.Failed[b].Key })
+
+	if r.stopped != nil {
+		return WrapError(r.stopped, r.Operation, fmt.Sprintf("stopped early, %d objects were not started", r.notStarted))
+	}
+
+	if len(r.Failed) > 0 {
+		return WrapError(fmt.Errorf("%s error", r.Operation), r.Operation, fmt.Sprintf("%d of %d objects failed", len(r.Failed), len(r.Succeeded)+len(r.Skipped)+len(r.Failed)))
+	}
+	return nil
+}
+
+// Summary is a single line description of the report
+func (r *OperationReport) Summary() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return fmt.Sprintf("%s: %d succeeded, %d skipped, %d failed, %d retries, %s in %s",
+		r.Operation, len(r.Succeeded), len(r.Skipped), len(r.Failed), r.Retries, FormatBytes(r.Bytes), r.Duration.Round(time.Millisecond))
+}
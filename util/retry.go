@@ -0,0 +1,152 @@
+package util
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RetryPolicy is how requests that failed for a passing reason, like throttling or a dropped connection, are tried again
+// zero values use the defaults
+type RetryPolicy struct {
+	// MaxAttempts counts the first try, so 1 does not retry
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, and doubles for every retry after it, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the part of each wait, from 0 to 1, that is random, so that workers do not retry in step
+	Jitter float64
+	// NoJitter waits the exact delay, since a zero Jitter uses the default
+	NoJitter bool
+}
+
+// DefaultRetryPolicy is used for anything that is not set
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    20 * time.Second,
+	Jitter:      0.5,
+}
+
+// withDefaults fills in what is not set
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if p.NoJitter {
+		p.Jitter = 0
+	} else if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = DefaultRetryPolicy.Jitter
+	}
+	return p
+}
+
+// Delay gets the wait before a retry, where the first retry is 0
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	p = p.withDefaults()
+
+	delay := p.MaxDelay
+	if retry < 32 && p.BaseDelay<<uint(retry) < p.MaxDelay && p.BaseDelay<<uint(retry) > 0 {
+		delay = p.BaseDelay << uint(retry)
+	}
+
+	// take a random part off, so the wait is never over the max
+	return delay - time.Duration(p.Jitter*rand.Float64()*float64(delay))
+}
+
+// transient s3 error codes, on top of the ones that the sdk already retries
+var transientS3Codes = map[string]bool{
+	"SlowDown":           true,
+	"ServiceUnavailable": true,
+	"InternalError":      true,
+	"RequestTimeout":     true,
+}
+
+// IsTransientS3Error tells if a request failed for a passing reason, and can be tried again
+// like throttling, a 5xx response, or a connection that was reset or timed out
+func IsTransientS3Error(err error, statusCode int) bool {
+	if err == nil {
+		return false
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case request.CanceledErrorCode:
+			return false
+		}
+		if transientS3Codes[aerr.Code()] {
+			return true
+		}
+	}
+	switch statusCode {
+	case 429, 500, 502, 503, 504:
+		return true
+	}
+	return request.IsErrorRetryable(err) || request.IsErrorThrottle(err)
+}
+
+// s3Retryer retries s3 requests with a retry policy
+// every request goes through it, including each page of a listing and each part of a multipart transfer
+type s3Retryer struct {
+	policy RetryPolicy
+}
+
+// MaxRetries is the number of tries after the first one
+func (r *s3Retryer) MaxRetries() int {
+	return r.policy.withDefaults().MaxAttempts - 1
+}
+
+// ShouldRetry tells if a failed request is tried again
+func (r *s3Retryer) ShouldRetry(req *request.Request) bool {
+	// a stopped command does not retry
+	if req.Context().Err() != nil {
+		return false
+	}
+	// some handlers already know, like for an expired signature
+	if req.Retryable != nil {
+		return *req.Retryable
+	}
+	statusCode := 0
+	if req.HTTPResponse != nil {
+		statusCode = req.HTTPResponse.StatusCode
+	}
+	return IsTransientS3Error(req.Error, statusCode)
+}
+
+// RetryRules gets the wait before a retry, and logs and counts the retry
+// it is only asked once the request will be retried
+func (r *s3Retryer) RetryRules(req *request.Request) time.Duration {
+	delay := r.policy.Delay(req.RetryCount)
+
+	path := ""
+	if req.HTTPRequest != nil && req.HTTPRequest.URL != nil {
+		path = req.HTTPRequest.URL.Path
+	}
+	contextLogger(req.Context()).Warnf("RETRY: %s %s (attempt %d of %d) in %s: %s", req.Operation.Name, path, req.RetryCount+2, r.MaxRetries()+1, delay.Round(time.Millisecond), req.Error)
+	countRetry(req.Context())
+
+	return delay
+}
+
+// reportContextKey is where an operation report is kept in a context
+type reportContextKey struct{}
+
+// WithOperationReport keeps a report in a context, so that retries made for it are counted in it
+func WithOperationReport(ctx context.Context, report *OperationReport) context.Context {
+	return context.WithValue(ctx, reportContextKey{}, report)
+}
+
+// countRetry counts a retry in the report of the context, if there is one
+func countRetry(ctx context.Context) {
+	if report, ok := ctx.Value(reportContextKey{}).(*OperationReport); ok {
+		report.Retry()
+	}
+}
@@ -0,0 +1,137 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// storage backend identifiers for `--backend`
+var (
+	StorageBackendS3 = "s3"
+	StorageBackendFS = "fs"
+)
+
+// Storage describes a backend that holds objects by key
+// every command talks to this, and not to a specific backend
+// so that other backends can be added without touching command code
+// every call stops when its context is done
+type Storage interface {
+	// List gets the objects ("files") and common keys ("directories") under a key
+	List(ctx context.Context, bucket, key string, useDelimiter bool) ([]*S3Object, []*S3Directory, error)
+	// Head gets the details and metadata of an object, and fails if it does not exist
+	Head(ctx context.Context, bucket, key string) (*S3Object, error)
+	// ACL gets the canned acl that matches the grants of an object, like "public-read"
+	// it is empty for backends without acls
+	ACL(ctx context.Context, bucket, key string) (string, error)
+	// Get downloads a single object into memory
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+	// Download streams a single object to a file
+	Download(ctx context.Context, bucket, key, absFilePath string) error
+	// Put streams a single object
+	Put(ctx context.Context, bucket, acl, key string, body io.Reader) error
+	// Copy copies an object to another key, possibly in another bucket
+	// the copy keeps the content type, headers and metadata of the source, unless the options change them
+	Copy(ctx context.Context, srcBucket, srcKey, destBucket, destKey string, opts CopyOptions) error
+	// Delete removes an object
+	Delete(ctx context.Context, bucket, key string) error
+	// DeleteMany removes many objects, in as few requests as possible
+	// it returns the keys that failed, and why, which is empty when everything was deleted
+	DeleteMany(ctx context.Context, bucket string, keys []string) map[string]error
+}
+
+// StorageBackend gets the backend that the accessor uses
+// a `file://` bucket always uses fs, and the default is s3
+func (config *S3Accessor) StorageBackend() string {
+	if strings.HasPrefix(config.Bucket, FSBucketScheme) {
+		return StorageBackendFS
+	}
+	if len(config.Backend) == 0 {
+		return StorageBackendS3
+	}
+	return strings.ToLower(config.Backend)
+}
+
+// NewStorage gets the storage backend described by the accessor
+// a `file://` bucket always selects the local filesystem
+// with rate or bandwidth limits, the backend is limited by the ones shared by everything built from the accessor
+// s3 limits every request that it sends, and both backends charge bytes while they move
+func NewStorage(config *S3Accessor) (Storage, error) {
+	funcTag := "NewStorage"
+
+	var storage Storage
+	switch backend := config.StorageBackend(); backend {
+	case StorageBackendFS:
+		_, bytes := config.limiters()
+		storage = &FSStorage{Bytes: bytes}
+	case StorageBackendS3:
+		s3Storage, err := NewS3Storage(config)
+		if err != nil {
+			return nil, WrapError(err, funcTag, "failed to get s3 storage")
+		}
+		storage = s3Storage
+	default:
+		return nil, WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("unsupported storage backend: %s", backend))
+	}
+
+	return storage, nil
+}
+
+// CopyOptions are how an object is copied
+// headers that are not set are kept from the source
+type CopyOptions struct {
+	ACL string
+	// Metadata is added to the metadata of the source, and wins for keys that are in both
+	Metadata map[string]string
+	// DropMetadata are keys of the metadata of the source that the copy does not keep
+	DropMetadata       []string
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+}
+
+// ChangesSource tells if the copy is not the same as the source, apart from the acl
+func (opts CopyOptions) ChangesSource() bool {
+	return len(opts.Metadata) > 0 || len(opts.DropMetadata) > 0 || len(opts.ContentType) > 0 || len(opts.ContentDisposition) > 0 || len(opts.CacheControl) > 0
+}
+
+// RenameObject renames an object and returns an error, if any
+// this is a copy, followed by a delete of the original
+func RenameObject(ctx context.Context, storage Storage, srcBucket, srcKey, destBucket, destKey string, opts CopyOptions) error {
+	funcTag := "RenameObject"
+
+	// copy the original object to a new key
+	err := storage.Copy(ctx, srcBucket, srcKey, destBucket, destKey, opts)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to copy object")
+	}
+
+	// remove the original object from the bucket
+	err = storage.Delete(ctx, srcBucket, srcKey)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to delete original object after copying during rename operation")
+	}
+
+	return nil
+}
+
+// WriteFile streams a single file from disk to a storage backend
+func WriteFile(ctx context.Context, storage Storage, bucket, acl, targetKey string, waffle *WalkedFile) error {
+	funcTag := "WriteFile"
+
+	// Open the file for use
+	file, err := os.Open(waffle.Path)
+	if err != nil {
+		return WrapError(err, funcTag, "failed to open file")
+	}
+	defer file.Close()
+
+	err = storage.Put(ctx, bucket, acl, targetKey, file)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to write file: %s", waffle.Path))
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"fmt"
+	"time"
+)
+
+// ParseTimeInput parses a point in time from the cli
+// it can be a RFC3339 timestamp ("2006-01-02T15:04:05Z07:00"), a date ("2006-01-02"),
+// or a duration before now ("36h")
+func ParseTimeInput(input string) (time.Time, error) {
+	funcTag := "ParseTimeInput"
+
+	if t, err := time.Parse(time.RFC3339, input); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", input, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(input); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Time{}, WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("cannot parse as a timestamp, date or duration: %s", input))
+}
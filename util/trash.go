@@ -0,0 +1,204 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TrashTimeFormat is the format of the timestamp directory in trash keys
+// it goes down to the nanosecond, so that deleting the same key twice in a second does not overwrite the first one
+var TrashTimeFormat = "2006-01-02T15-04-05.000000000"
+
+// secondTimeFormat is the timestamp of journal and history names, which have their own random part
+// it also parses trash timestamps with or without the fraction of a second, like the ones of older trash keys
+var secondTimeFormat = "2006-01-02T15-04-05"
+
+// metadata recorded on trashed objects
+// values are url escaped, since s3 metadata has to be plain ascii
+var (
+	TrashMetaOriginalKey = "snapr-original-key"
+	TrashMetaDeletedBy   = "snapr-deleted-by"
+	// TrashMetaACL is the acl the object had, since objects in the trash are private
+	TrashMetaACL = "snapr-acl"
+)
+
+// TrashMetaKeys are the metadata keys that only make sense in the trash
+var TrashMetaKeys = []string{TrashMetaOriginalKey, TrashMetaDeletedBy, TrashMetaACL}
+
+// TrashEntry is an object in the trash
+type TrashEntry struct {
+	Object      *S3Object `json:"object"`
+	OriginalKey string    `json:"original_key"`
+	DeletedAt   time.Time `json:"deleted_at"`
+	DeletedBy   string    `json:"deleted_by,omitempty"`
+}
+
+// IsTrashKey tells if a key is in the trash
+func IsTrashKey(trashDir, key string) bool {
+	return strings.HasPrefix(key, EnsureS3DirPath(trashDir))
+}
+
+// TrashKey gets the key that an object is moved to when it is deleted
+// example: `.trash/2006-01-02T15-04-05.000000000/photos/me.jpg`
+func TrashKey(trashDir string, deletedAt time.Time, key string) string {
+	return JoinS3Path(JoinS3Path(trashDir, deletedAt.UTC().Format(TrashTimeFormat)), key)
+}
+
+// ParseTrashKey gets the original key and deletion time from a trash key
+func ParseTrashKey(trashDir, trashKey string) (*TrashEntry, error) {
+	funcTag := "ParseTrashKey"
+
+	if !IsTrashKey(trashDir, trashKey) {
+		return nil, WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("key is not in the trash: %s", trashKey))
+	}
+
+	// split off the timestamp dir
+	parts := strings.SplitN(strings.TrimPrefix(trashKey, EnsureS3DirPath(trashDir)), S3Delimiter, 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return nil, WrapError(fmt.Errorf("validation error"), funcTag, fmt.Sprintf("key has no timestamp directory: %s", trashKey))
+	}
+	deletedAt, err := ParseTrashTime(parts[0])
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to parse timestamp directory: %s", trashKey))
+	}
+
+	return &TrashEntry{
+		Object:      &S3Object{Key: trashKey},
+		OriginalKey: parts[1],
+		DeletedAt:   deletedAt,
+	}, nil
+}
+
+// ParseTrashTime parses the timestamp directory of a trash key
+// the fraction of a second can be left out
+func ParseTrashTime(value string) (time.Time, error) {
+	return time.Parse(secondTimeFormat, value)
+}
+
+// MatchTrashTime tells if an object was deleted at a time given for it
+// a time without a fraction of a second matches every delete in that second
+func MatchTrashTime(deletedAt, at time.Time) bool {
+	if at.Nanosecond() == 0 {
+		return deletedAt.Truncate(time.Second).Equal(at)
+	}
+	return deletedAt.Equal(at)
+}
+
+// CopyToTrash copies an object into the trash, and returns the trash key
+// the original key, the deleter and the acl are recorded in the object metadata
+func CopyToTrash(ctx context.Context, storage Storage, bucket, trashDir, key, deletedBy string, deletedAt time.Time) (string, error) {
+	funcTag := "CopyToTrash"
+
+	trashKey := TrashKey(trashDir, deletedAt, key)
+	metadata := map[string]string{
+		TrashMetaOriginalKey: url.PathEscape(key),
+		TrashMetaDeletedBy:   url.PathEscape(deletedBy),
+	}
+
+	// the trash copy is private, so a restore needs to know what it was
+	acl, err := storage.ACL(ctx, bucket, key)
+	if err != nil {
+		return trashKey, WrapError(err, funcTag, "failed to get acl of object")
+	}
+	if len(acl) > 0 {
+		metadata[TrashMetaACL] = acl
+	}
+
+	err = storage.Copy(ctx, bucket, key, bucket, trashKey, CopyOptions{ACL: "private", Metadata: metadata})
+	if err != nil {
+		return trashKey, WrapError(err, funcTag, "failed to copy object to trash")
+	}
+
+	return trashKey, nil
+}
+
+// TrashObject moves an object into the trash, and returns the trash key
+func TrashObject(ctx context.Context, storage Storage, bucket, trashDir, key, deletedBy string, deletedAt time.Time) (string, error) {
+	funcTag := "TrashObject"
+
+	// copy the object into the trash
+	trashKey, err := CopyToTrash(ctx, storage, bucket, trashDir, key, deletedBy, deletedAt)
+	if err != nil {
+		return trashKey, WrapError(err, funcTag, "failed to move object to trash")
+	}
+
+	// remove the original object from the bucket
+	err = storage.Delete(ctx, bucket, key)
+	if err != nil {
+		return trashKey, WrapError(err, funcTag, "failed to delete original object after copying to trash")
+	}
+
+	return trashKey, nil
+}
+
+// RestoreObject moves an object back to the key it was moved from, like out of the trash or back from a rename
+// the restored object does not keep the trash metadata, and gets back the acl recorded in the trash,
+// or else keeps the acl that it has now
+func RestoreObject(ctx context.Context, storage Storage, srcBucket, srcKey, destBucket, destKey string) error {
+	funcTag := "RestoreObject"
+
+	head, err := storage.Head(ctx, srcBucket, srcKey)
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to get object: %s", srcKey))
+	}
+	acl := head.Metadata[TrashMetaACL]
+	if len(acl) == 0 {
+		acl, err = storage.ACL(ctx, srcBucket, srcKey)
+		if err != nil {
+			return WrapError(err, funcTag, fmt.Sprintf("failed to get acl of object: %s", srcKey))
+		}
+	}
+
+	err = RenameObject(ctx, storage, srcBucket, srcKey, destBucket, destKey, CopyOptions{ACL: acl, DropMetadata: TrashMetaKeys})
+	if err != nil {
+		return WrapError(err, funcTag, fmt.Sprintf("failed to move object back: %s", srcKey))
+	}
+
+	return nil
+}
+
+// ListTrash gets everything in the trash, newest first
+// with details, each object is checked for the deleter (one request per object)
+func ListTrash(ctx context.Context, storage Storage, bucket, trashDir string, details bool) ([]*TrashEntry, error) {
+	funcTag := "ListTrash"
+
+	objects, _, err := storage.List(ctx, bucket, EnsureS3DirPath(trashDir), false)
+	if err != nil {
+		return nil, WrapError(err, funcTag, fmt.Sprintf("failed to list trash: %s", trashDir))
+	}
+
+	var entries []*TrashEntry
+	for _, object := range objects {
+		entry, err := ParseTrashKey(trashDir, object.Key)
+		if err != nil {
+			// not put there by us, leave it alone
+			continue
+		}
+		entry.Object = object
+
+		if details {
+			head, err := storage.Head(ctx, bucket, object.Key)
+			if err != nil {
+				return entries, WrapError(err, funcTag, fmt.Sprintf("failed to get details of trash object: %s", object.Key))
+			}
+			if deletedBy, err := url.PathUnescape(head.Metadata[TrashMetaDeletedBy]); err == nil {
+				entry.DeletedBy = deletedBy
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool {
+		if !entries[a].DeletedAt.Equal(entries[b].DeletedAt) {
+			return entries[a].DeletedAt.After(entries[b].DeletedAt)
+		}
+		return entries[a].OriginalKey < entries[b].OriginalKey
+	})
+
+	return entries, nil
+}
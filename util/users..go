@@ -2,7 +2,9 @@ package util
 
 import (
 	"bytes"
+	"os"
 	"os/exec"
+	"os/user"
 	"strings"
 )
 
@@ -30,3 +32,15 @@ func OSUsers() (usersOutput string, err error) {
 	// done
 	return
 }
+
+// CurrentUser gets the name of the user running this process
+// this falls back to the environment, and then to "unknown"
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && len(u.Username) > 0 {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); len(name) > 0 {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,61 @@
+package util
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// build metadata, set with ldflags by build-all-platforms.sh
+// example: `go build -ldflags "-X snapr/util.Version=1.0.1 -X snapr/util.Commit=1a2b3c4 -X snapr/util.BuildDate=2006-01-02T15:04:05Z"`
+var (
+	Version   = ""
+	Commit    = ""
+	BuildDate = ""
+)
+
+// VersionInfo describes the binary, so that it can be traced
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	BuildMode string `json:"build_mode"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// GetVersionInfo gets the version of this binary
+// without ldflags, the version falls back to SNAPR_VERSION, like from the compiled-in .env
+func GetVersionInfo() VersionInfo {
+	info := VersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		BuildMode: Build.Mode,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if len(info.Version) == 0 {
+		info.Version = EnvVarString("VERSION", "0.0.0-dev")
+	}
+	if len(info.Commit) == 0 {
+		info.Commit = "unknown"
+	}
+	if len(info.BuildDate) == 0 {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// String gets the version on one line
+// example: `snapr 1.0.1 (commit 1a2b3c4, built 2006-01-02T15:04:05Z, prod, go1.13.5 linux/amd64)`
+func (v VersionInfo) String() string {
+	return fmt.Sprintf("snapr %s (commit %s, built %s, %s, %s %s/%s)", v.Version, v.Commit, v.BuildDate, v.BuildMode, v.GoVersion, v.OS, v.Arch)
+}
+
+// UserAgent gets the part of the User-Agent that names this binary
+// example: `snapr/1.0.1 (1a2b3c4; prod)`
+func (v VersionInfo) UserAgent() string {
+	return fmt.Sprintf("snapr/%s (%s; %s)", v.Version, v.Commit, v.BuildMode)
+}